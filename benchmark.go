@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -10,30 +11,89 @@ type Benchmark struct {
 	collector chan *Record
 }
 
+// Job is a request to send, templated requests are rendered by the http
+// worker from the job variables
+type Job struct {
+	request *http.Request
+	seq     int
+	data    map[string]string
+}
+
 type Record struct {
 	responseTime time.Duration
 	contentSize  int64
+	bodySent     int64
 	Error        error
+
+	decodedSize int64 // body size after Content-Encoding is decoded
+	decodeTime  time.Duration
+	encoding    string
+
+	wireReceived int64 // bytes on the wire including headers
+	wireSent     int64
+
+	proxyConnect time.Duration // zero unless a new connection was made through a proxy
+	remoteIP     string        // of the connection the request was sent on
+	protocol     string        // of the response, eg. HTTP/1.1 or HTTP/2.0
+	status       int           // of the response, zero unless one was received
+	tlsHandshake time.Duration // zero unless a new TLS connection was made
+	tlsResumed   bool
+	upgrade      time.Duration // websocket handshake, with the first message of a websocket
+
+	grpcStatus string // name of the status of a gRPC call
+
+	events     int // of a streamed response
+	firstEvent time.Duration
+	eventGaps  []time.Duration
+
+	steps []*Record // records of the steps of a scenario, in order
 }
 
 func NewBenchmark(context *Context) *Benchmark {
-	collector := make(chan *Record, context.config.requests)
+	collector := make(chan *Record, context.config.concurrency)
 	return &Benchmark{context, collector}
 }
 
+// Run issues jobs until all requests are sent or the context is stopped,
+// a run without the number of requests is bounded by the time limit only.
+// The collector is closed once every worker has returned
 func (b *Benchmark) Run() {
 
-	jobs := make(chan *http.Request, b.c.config.concurrency*GoMaxProcs)
+	jobs := make(chan *Job, b.c.config.concurrency*b.c.config.goMaxProcs)
 
+	var workers sync.WaitGroup
 	for i := 0; i < b.c.config.concurrency; i++ {
-		go NewHTTPWorker(b.c, jobs, b.collector).Run()
+		workers.Add(1)
+		go func(id int) {
+			defer workers.Done()
+			NewHTTPWorker(b.c, id, jobs, b.collector).Run()
+		}(i + 1)
 	}
 
-	base, _ := NewHTTPRequest(b.c.config)
-	for i := 0; i < b.c.config.requests; i++ {
-		jobs <- CopyHTTPRequest(b.c.config, base)
+	config := b.c.config
+	base, _ := NewHTTPRequest(b.c.work, config)
+
+produce:
+	for i := 0; config.requests == 0 || i < config.requests; i++ {
+		job := &Job{seq: i + 1}
+		if config.template == nil && config.scenario == nil {
+			job.request = CopyHTTPRequest(base)
+		} else if config.feeder != nil {
+			var ok bool
+			if job.data, ok = config.feeder.Next(); !ok {
+				// unique rows are exhausted
+				break produce
+			}
+		}
+
+		select {
+		case jobs <- job:
+		case <-b.c.jobs.Done():
+			break produce
+		}
 	}
 	close(jobs)
 
-	<-b.c.stop
+	workers.Wait()
+	close(b.collector)
 }
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestBenchmark(t *testing.T) {
@@ -32,21 +33,91 @@ func TestBenchmark(t *testing.T) {
 
 	go benchmark.Run()
 
-	go func() {
-		counter := 0
-		for record := range benchmark.collector {
-			counter++
-			if counter == requests || record.Error != nil {
-				break
-			}
+	// the collector is closed once all of http workers have returned
+	counter := 0
+	for record := range benchmark.collector {
+		counter++
+		if record.Error != nil {
+			t.Fatalf("sent a http reqeust but was error: %s", record.Error)
 		}
-		close(context.stop)
-	}()
+	}
+	context.abort()
+
+	if actualReceived := atomic.LoadInt64(&received); int64(requests) != actualReceived || counter != requests {
+		t.Fatalf("expected to send %d requests and receive %d responses, but got %d responses and %d records", requests, requests, actualReceived, counter)
+	}
+}
+
+func TestBenchmarkWithStop(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         10000,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	counter := 0
+	for range benchmark.collector {
+		counter++
+		if counter == 10 {
+			context.stop()
+		}
+	}
+	context.abort()
 
-	context.start.Wait()
-	<-context.stop
+	if counter >= config.requests {
+		t.Fatalf("expected benchmark to stop issuing jobs after stop, but got %d records", counter)
+	}
+}
+
+func TestBenchmarkWithTimelimit(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	// no number of requests, runs until the time limit is reached
+	config := &Config{
+		concurrency:      2,
+		timelimit:        1,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	sw := &StopWatch{}
+	sw.Start()
+	go benchmark.Run()
+
+	counter := 0
+	for range benchmark.collector {
+		counter++
+	}
+	sw.Stop()
+
+	if sw.Elapsed < time.Second {
+		t.Fatalf("expected benchmark to run until the time limit, but stopped after %s", sw.Elapsed)
+	}
 
-	if actualReceived := atomic.LoadInt64(&received); int64(requests) != actualReceived {
-		t.Fatalf("expected to send %d requests and receive %d responses, but got %d responses", requests, requests, actualReceived)
+	if counter == 0 {
+		t.Fatal("expected benchmark to collect records until the time limit")
 	}
 }
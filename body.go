@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// FileBody streams a request body from a file, the file is opened on the
+// first read so queued requests don't hold file descriptors
+type FileBody struct {
+	name string
+	file *os.File
+}
+
+func NewFileBody(name string) *FileBody {
+	return &FileBody{name: name}
+}
+
+func (b *FileBody) Read(p []byte) (n int, err error) {
+	if b.file == nil {
+		if b.file, err = os.Open(b.name); err != nil {
+			return
+		}
+	}
+	return b.file.Read(p)
+}
+
+func (b *FileBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	return b.file.Close()
+}
+
+// CountingBody counts the bytes of a request body read by the transport,
+// it may be read from another goroutine than the one sending the request
+type CountingBody struct {
+	body io.ReadCloser
+	n    int64
+}
+
+func (b *CountingBody) Read(p []byte) (n int, err error) {
+	n, err = b.body.Read(p)
+	atomic.AddInt64(&b.n, int64(n))
+	return
+}
+
+func (b *CountingBody) Close() error {
+	return b.body.Close()
+}
+
+func (b *CountingBody) Count() int64 {
+	return atomic.LoadInt64(&b.n)
+}
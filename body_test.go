@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileBody(t *testing.T) {
+	// closing an unread body doesn't open the file
+	if err := NewFileBody("testdata/missing.txt").Close(); err != nil {
+		t.Fatalf("expected unread body to close, got %s", err)
+	}
+
+	body := NewFileBody("testdata/postfile.txt")
+	defer body.Close()
+
+	expected, _ := ioutil.ReadFile("testdata/postfile.txt")
+	actual, err := ioutil.ReadAll(body)
+	if err != nil || string(actual) != string(expected) {
+		t.Fatalf("expected %q, got %q (%v)", expected, actual, err)
+	}
+}
+
+func TestCountingBody(t *testing.T) {
+	body := &CountingBody{body: ioutil.NopCloser(strings.NewReader("hello"))}
+	ioutil.ReadAll(body)
+
+	if body.Count() != 5 {
+		t.Fatalf("expected 5 bytes, got %d", body.Count())
+	}
+}
+
+func TestHTTPWithStreamedBody(t *testing.T) {
+	info, _ := os.Stat("testdata/postfile.txt")
+
+	for _, chunked := range []bool{false, true} {
+		var contentLength int64
+		var transferEncoding []string
+		var received int
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentLength = r.ContentLength
+			transferEncoding = r.TransferEncoding
+			body, _ := ioutil.ReadAll(r.Body)
+			received = len(body)
+			w.Write([]byte("hello"))
+		}))
+
+		config := &Config{
+			concurrency:      1,
+			requests:         2,
+			method:           "PUT",
+			executionTimeout: MaxExecutionTimeout,
+			url:              ts.URL,
+			streamBody:       true,
+			chunked:          chunked,
+		}
+		loadFile(config, "testdata/postfile.txt")
+
+		if config.bodyContent != nil || config.bodySize != info.Size() {
+			t.Fatal("expected streamed body not to be loaded into memory")
+		}
+
+		context := NewContext(config)
+		context.SetInt(FieldContentSize, 5)
+		benchmark := NewBenchmark(context)
+
+		go benchmark.Run()
+
+		stats := &Stats{}
+		for record := range benchmark.collector {
+			if record.Error != nil {
+				t.Fatalf("sent a http reqeust but was error: %s", record.Error)
+			}
+			updateStats(stats, record)
+		}
+		context.abort()
+		ts.Close()
+
+		if int64(received) != info.Size() || stats.totalSent != 2*info.Size() {
+			t.Fatalf("expected %d bytes received and %d bytes sent, got %d and %d", info.Size(), 2*info.Size(), received, stats.totalSent)
+		}
+
+		if chunked && (contentLength != -1 || len(transferEncoding) == 0 || transferEncoding[0] != "chunked") {
+			t.Fatalf("expected chunked body, got content length %d and %v", contentLength, transferEncoding)
+		}
+
+		if !chunked && contentLength != info.Size() {
+			t.Fatalf("expected content length %d, got %d", info.Size(), contentLength)
+		}
+	}
+}
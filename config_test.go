@@ -1,7 +1,10 @@
 package main
 
 import (
+	"flag"
+	"io/ioutil"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -27,3 +30,49 @@ func TestExtractHostAndPort(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadBody(t *testing.T) {
+	config := &Config{}
+
+	if err := loadBody(config, `{"inline": true}`); err != nil || string(config.bodyContent) != `{"inline": true}` {
+		t.Fatalf("expected inline body, got %q (%v)", config.bodyContent, err)
+	}
+
+	if err := loadBody(config, "@testdata/postfile.txt"); err != nil || !strings.Contains(string(config.bodyContent), "email=test") {
+		t.Fatalf("expected body from file, got %q (%v)", config.bodyContent, err)
+	}
+
+	if err := loadBody(config, "@testdata/missing.txt"); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestIsToken(t *testing.T) {
+	testData := map[string]bool{
+		"GET":      true,
+		"PATCH":    true,
+		"PROPFIND": true,
+		"M-SEARCH": true,
+		"":         false,
+		"GET /":    false,
+		"A(B)":     false,
+	}
+
+	for testingData, expectedData := range testData {
+		if actual := isToken(testingData); actual != expectedData {
+			t.Errorf("expected %t for %q, got %t", expectedData, testingData, actual)
+		}
+	}
+}
+
+func TestParseConfigMethod(t *testing.T) {
+	if config := parseTestConfig(t, "-m", "Purge", "http://localhost/"); config.method != "Purge" {
+		t.Fatalf("expected the method as given, got %q", config.method)
+	}
+
+	flags := flag.NewFlagSet("gb", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	if _, err := ParseConfig(flags, []string{"-m", "GET /", "http://localhost/"}); err == nil {
+		t.Fatal("expected error for a method which is not a token")
+	}
+}
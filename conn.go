@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Traffic counts bytes read from and written to the connections of a
+// client, including headers and TLS handshakes. The TCP_INFO of closed
+// connections is collected into tcpInfo when it is given
+type Traffic struct {
+	received int64
+	sent     int64
+	tcpInfo  *TCPInfoStats
+}
+
+func (t *Traffic) Received() int64 {
+	return atomic.LoadInt64(&t.received)
+}
+
+func (t *Traffic) Sent() int64 {
+	return atomic.LoadInt64(&t.sent)
+}
+
+type CountingConn struct {
+	net.Conn
+	traffic *Traffic
+	closed  int32
+}
+
+func (c *CountingConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	atomic.AddInt64(&c.traffic.received, int64(n))
+	return
+}
+
+func (c *CountingConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	atomic.AddInt64(&c.traffic.sent, int64(n))
+	return
+}
+
+func (c *CountingConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) && c.traffic.tcpInfo != nil {
+		if info, ok := readTCPInfo(c.Conn); ok {
+			c.traffic.tcpInfo.Add(info)
+		}
+	}
+	return c.Conn.Close()
+}
+
+// NewDialer returns the dial function of the transport, connections are
+// counted into traffic when it is given and dialed to the Unix domain socket
+// or the address of the resolver when configured. Source addresses are
+// rotated per connection and the tcp options of the config are applied
+func NewDialer(config *Config, traffic *Traffic) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	keepAlive := config.tcpKeepAlive
+	if keepAlive == 0 {
+		keepAlive = DefaultTCPKeepAlive
+	}
+
+	dialers := []*net.Dialer{{
+		Timeout:   time.Duration(30) * time.Second,
+		KeepAlive: keepAlive,
+	}}
+
+	if len(config.sourceAddrs) > 0 {
+		dialers = nil
+		for _, ip := range config.sourceAddrs {
+			dialers = append(dialers, &net.Dialer{
+				Timeout:   time.Duration(30) * time.Second,
+				KeepAlive: keepAlive,
+				LocalAddr: &net.TCPAddr{IP: ip},
+			})
+		}
+	}
+
+	var next uint32
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialer := dialers[(atomic.AddUint32(&next, 1)-1)%uint32(len(dialers))]
+
+		if config.unixSocket != "" {
+			network, addr = "unix", config.unixSocket
+		} else if config.resolver != nil {
+			var err error
+			if addr, err = config.resolver.Resolve(ctx, addr); err != nil {
+				return nil, err
+			}
+		}
+
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = applyTCPOptions(config, conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		if traffic == nil {
+			return conn, nil
+		}
+		return &CountingConn{Conn: conn, traffic: traffic}, nil
+	}
+}
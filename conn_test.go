@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPWithWireTraffic(t *testing.T) {
+	responseStr := "hello"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(responseStr))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         2,
+		method:           "POST",
+		keepAlive:        true,
+		bodyContent:      []byte("ping"),
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, len(responseStr))
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	var records []*Record
+	for record := range benchmark.collector {
+		if record.Error != nil {
+			t.Fatalf("sent a http reqeust but was error: %s", record.Error)
+		}
+		records = append(records, record)
+	}
+	context.abort()
+
+	for _, record := range records {
+		// status line and headers are counted on top of the bodies
+		if record.wireReceived <= record.contentSize || record.wireSent <= record.bodySent || record.bodySent != 4 {
+			t.Fatalf("expected wire bytes to include headers, got %d received for %d body bytes and %d sent for %d body bytes",
+				record.wireReceived, record.contentSize, record.wireSent, record.bodySent)
+		}
+	}
+
+	// the connection is reused, traffic is attributed per request
+	if records[0].wireSent != records[1].wireSent {
+		t.Fatalf("expected identical requests to send the same bytes, got %d and %d", records[0].wireSent, records[1].wireSent)
+	}
+}
+
+func TestHTTPWithUnixSocket(t *testing.T) {
+	responseStr := "hello"
+
+	dir, err := ioutil.TempDir("", "gb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "app.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(responseStr))
+	}))
+	ts.Listener = listener
+	ts.Start()
+	defer ts.Close()
+
+	records := runConnBenchmark(t, &Config{
+		url:        "http://sidecar/",
+		unixSocket: listener.Addr().String(),
+	}, responseStr)
+
+	for _, record := range records {
+		if record.Error != nil {
+			t.Fatalf("sent a http reqeust over a unix socket but was error: %s", record.Error)
+		}
+	}
+}
+
+func TestHTTPWithSourceAddress(t *testing.T) {
+	responseStr := "hello"
+
+	var remoteAddrs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddrs = append(remoteAddrs, r.RemoteAddr)
+		w.Write([]byte(responseStr))
+	}))
+	defer ts.Close()
+
+	records := runConnBenchmark(t, &Config{
+		url:         ts.URL,
+		sourceAddrs: []net.IP{net.ParseIP("127.0.0.1")},
+	}, responseStr)
+
+	for _, record := range records {
+		if record.Error != nil {
+			t.Fatalf("sent a http reqeust from a source address but was error: %s", record.Error)
+		}
+	}
+	for _, remoteAddr := range remoteAddrs {
+		if host, _, _ := net.SplitHostPort(remoteAddr); host != "127.0.0.1" {
+			t.Fatalf("expected connections from 127.0.0.1, got %s", remoteAddr)
+		}
+	}
+
+	// binding to an address the host doesn't have fails like running out
+	// of ephemeral ports does
+	records = runConnBenchmark(t, &Config{
+		url:         ts.URL,
+		sourceAddrs: []net.IP{net.ParseIP("192.0.2.1")},
+	}, responseStr)
+
+	for _, record := range records {
+		if _, ok := record.Error.(*PortExhaustedError); !ok {
+			t.Fatalf("expected a PortExhaustedError, got %#v", record.Error)
+		}
+	}
+}
+
+func runConnBenchmark(t *testing.T, config *Config, responseStr string) []*Record {
+	config.concurrency = 1
+	config.requests = 2
+	config.method = "GET"
+	config.executionTimeout = MaxExecutionTimeout
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, len(responseStr))
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	var records []*Record
+	for record := range benchmark.collector {
+		records = append(records, record)
+	}
+	context.abort()
+	return records
+}
@@ -1,21 +1,82 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Context struct {
+	inflight int64 // number of requests being sent, accessed atomically
+	workers  int64 // number of http workers running, accessed atomically
+
 	config *Config
 	start  *sync.WaitGroup
-	stop   chan struct{}
-	rwm    *sync.RWMutex
-	store  map[string]interface{}
+
+	// jobs is canceled on graceful shutdown: no new jobs are issued but
+	// in-flight requests are allowed to finish
+	jobs context.Context
+	stop context.CancelFunc
+
+	// work is the parent of every request, it is canceled on hard shutdown
+	// or when the time limit is reached and aborts in-flight requests
+	work  context.Context
+	abort context.CancelFunc
+
+	// tcpInfo collects the TCP_INFO of connections closed by http workers
+	tcpInfo *TCPInfoStats
+
+	// metrics are exposed while running, nil unless enabled
+	metrics *Metrics
+
+	// pusher pushes aggregates to the sinks of the config, nil without sinks
+	pusher *Pusher
+
+	rwm   *sync.RWMutex
+	store map[string]interface{}
 }
 
 func NewContext(config *Config) *Context {
 	start := &sync.WaitGroup{}
 	start.Add(config.concurrency)
-	return &Context{config, start, make(chan struct{}), &sync.RWMutex{}, make(map[string]interface{})}
+
+	var work context.Context
+	var abort context.CancelFunc
+	if config.timelimit > 0 {
+		work, abort = context.WithTimeout(context.Background(), time.Duration(config.timelimit)*time.Second)
+	} else {
+		work, abort = context.WithCancel(context.Background())
+	}
+	jobs, stop := context.WithCancel(work)
+
+	c := &Context{
+		config:  config,
+		start:   start,
+		jobs:    jobs,
+		stop:    stop,
+		work:    work,
+		abort:   abort,
+		tcpInfo: &TCPInfoStats{},
+		rwm:     &sync.RWMutex{},
+		store:   make(map[string]interface{}),
+	}
+	if len(config.pushURLs) > 0 {
+		c.pusher = NewPusher(c)
+	}
+	return c
+}
+
+func (c *Context) Inflight() int {
+	return int(atomic.LoadInt64(&c.inflight))
+}
+
+func (c *Context) Workers() int {
+	return int(atomic.LoadInt64(&c.workers))
 }
 
 func (c *Context) SetString(key string, value string) {
@@ -41,3 +102,26 @@ func (c *Context) GetInt(key string) int {
 	defer c.rwm.RUnlock()
 	return c.store[key].(int)
 }
+
+// TraceException prints errors of requests by the verbosity of the config
+func (c *Context) TraceException(msg interface{}) {
+	switch {
+	case c.config.verbosity > 1:
+		// print recovered error and stacktrace
+		var buffer bytes.Buffer
+		buffer.WriteString(fmt.Sprintf("recover: %v\n", msg))
+		for skip := 1; ; skip++ {
+			pc, file, line, ok := runtime.Caller(skip)
+			if !ok {
+				break
+			}
+			f := runtime.FuncForPC(pc)
+			buffer.WriteString(fmt.Sprintf("\t%s:%d %s()\n", file, line, f.Name()))
+		}
+		buffer.WriteString("\n")
+		fmt.Fprint(os.Stderr, buffer.String())
+	case c.config.verbosity > 0:
+		// print recovered error only
+		fmt.Fprintf(os.Stderr, "recover: %v\n", msg)
+	}
+}
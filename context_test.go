@@ -29,3 +29,32 @@ func TestSetAndGetInt(t *testing.T) {
 		t.Fatalf("expected %d, got %d", value, got)
 	}
 }
+
+func TestStopAndAbort(t *testing.T) {
+	context := NewContext(&Config{})
+
+	context.stop()
+	if context.jobs.Err() == nil {
+		t.Fatal("expected jobs to be canceled after stop")
+	}
+	if context.work.Err() != nil {
+		t.Fatal("expected work not to be canceled after stop")
+	}
+
+	context.abort()
+	if context.work.Err() == nil {
+		t.Fatal("expected work to be canceled after abort")
+	}
+}
+
+func TestTimelimitDeadline(t *testing.T) {
+	context := NewContext(&Config{timelimit: 1})
+	defer context.abort()
+
+	if _, ok := context.work.Deadline(); !ok {
+		t.Fatal("expected work to have a deadline")
+	}
+	if _, ok := context.jobs.Deadline(); !ok {
+		t.Fatal("expected jobs to inherit the deadline")
+	}
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultAgentDelay = time.Duration(2) * time.Second
+)
+
+// agentRun is sent by the coordinator to start a benchmark on an agent
+type agentRun struct {
+	Args  []string  `json:"args"`
+	Start time.Time `json:"start"`
+}
+
+// agentResult is the reply of an agent once its benchmark has finished
+type agentResult struct {
+	ServerName  string `json:"serverName"`
+	ContentSize int    `json:"contentSize"`
+	Stats       *Stats `json:"stats"`
+}
+
+// Agent runs benchmarks sent by a coordinator, one at a time
+type Agent struct {
+	mu      sync.Mutex
+	running bool
+	signals chan os.Signal // of the monitor of the running benchmark
+	metrics *Metrics       // nil unless exposed
+
+	token      string // coordinators send it as a bearer token
+	allowFiles bool   // benchmarks may read files of the agent
+}
+
+func NewAgent(config *Config, metrics *Metrics) http.Handler {
+	agent := &Agent{metrics: metrics, token: config.agentToken, allowFiles: config.agentAllowFiles}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", agent.run)
+	mux.HandleFunc("/stop", agent.stop)
+	return mux
+}
+
+// RunAgent serves coordinators on the address of the config until it fails
+func RunAgent(config *Config) error {
+	var metrics *Metrics
+	if config.metrics != "" {
+		metrics = NewMetrics()
+		if err := ServeMetrics(config.metrics, metrics); err != nil {
+			return err
+		}
+	}
+
+	// all interfaces have to be asked for, an address without a host is
+	// only reachable from the local host
+	addr := config.agent
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Agent listening on %s\n", listener.Addr())
+	return http.Serve(listener, NewAgent(config, metrics))
+}
+
+func (a *Agent) run(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.authorized(r) {
+		http.Error(w, "invalid agent token", http.StatusUnauthorized)
+		return
+	}
+
+	var run agentRun
+	if err := json.NewDecoder(r.Body).Decode(&run); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	signals := make(chan os.Signal, 2)
+	a.mu.Lock()
+	if a.running {
+		a.mu.Unlock()
+		http.Error(w, "agent is running another benchmark", http.StatusConflict)
+		return
+	}
+	a.running, a.signals = true, signals
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		a.running, a.signals = false, nil
+		a.mu.Unlock()
+	}()
+
+	flags := flag.NewFlagSet("gb", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	config, err := parseConfig(flags, run.Args, a.allowFiles)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if config.agent != "" || len(config.agents) > 0 {
+		http.Error(w, "agents cannot distribute benchmarks further", http.StatusBadRequest)
+		return
+	}
+
+	// the host is detected ahead, the time limit starts with the benchmark
+	probe := NewContext(config)
+	err = DetectHost(probe)
+	probe.abort()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	select {
+	case <-time.After(time.Until(run.Start)):
+	case <-r.Context().Done():
+		return
+	}
+
+	context := NewContext(config)
+	context.SetString(FieldServerName, probe.GetString(FieldServerName))
+	context.SetInt(FieldContentSize, probe.GetInt(FieldContentSize))
+	if a.metrics != nil {
+		a.metrics.Attach(context)
+	}
+
+	benchmark := NewBenchmark(context)
+	monitor := NewMonitor(context, benchmark.collector)
+	monitor.signals = signals
+	go monitor.Run()
+	go benchmark.Run()
+
+	var stats *Stats
+	select {
+	case stats = <-monitor.output:
+	case <-r.Context().Done():
+		// the coordinator is gone
+		context.abort()
+		<-monitor.output
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&agentResult{
+		ServerName:  context.GetString(FieldServerName),
+		ContentSize: context.GetInt(FieldContentSize),
+		Stats:       stats,
+	})
+}
+
+// stop interrupts the running benchmark like a signal, in-flight requests
+// are aborted when it is stopped twice
+func (a *Agent) stop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.authorized(r) {
+		http.Error(w, "invalid agent token", http.StatusUnauthorized)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.signals != nil {
+		select {
+		case a.signals <- os.Interrupt:
+		default:
+		}
+	}
+}
+
+// authorized reports whether the request carries the token of the agent
+func (a *Agent) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return a.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// Distribute runs the benchmark of the context on its agents, starting
+// them at the same time, and merges their stats
+func Distribute(context *Context) (*Stats, error) {
+	config := context.config
+	client := &http.Client{}
+	start := time.Now().Add(config.agentDelay)
+
+	results := make([]*agentResult, len(config.agents))
+	errs := make([]error, len(config.agents))
+	done := make(chan int, len(config.agents))
+	for i, addr := range config.agents {
+		go func(i int, addr string) {
+			results[i], errs[i] = runAgent(client, addr, config.agentToken, &agentRun{agentArgs(config, i), start})
+			done <- i
+		}(i, addr)
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	fmt.Printf("Benchmarking %s with %d agents (be patient)\n", config.host, len(config.agents))
+
+	failed := false
+	for finished := 0; finished < len(config.agents); {
+		select {
+		case i := <-done:
+			finished++
+			if errs[i] == nil {
+				fmt.Printf("Agent %s finished %d requests\n", config.agents[i], results[i].Stats.totalRequests)
+				continue
+			}
+
+			fmt.Printf("Agent %s failed: %s\n", config.agents[i], errs[i])
+			if !failed {
+				// abort the others, the benchmark is incomplete
+				failed = true
+				stopAgents(client, config.agents, config.agentToken)
+				stopAgents(client, config.agents, config.agentToken)
+			}
+
+		case <-signals:
+			fmt.Println("Interrupted, stopping agents (interrupt again to abort)")
+			stopAgents(client, config.agents, config.agentToken)
+		}
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: %s", config.agents[i], err)
+		}
+	}
+
+	stats := &Stats{}
+	for i, result := range results {
+		stats.Merge(result.Stats)
+		stats.agents = append(stats.agents, &AgentStats{
+			name:                config.agents[i],
+			responseTimes:       result.Stats.responseTimes,
+			totalRequests:       result.Stats.totalRequests,
+			totalExecutionTime:  result.Stats.totalExecutionTime,
+			totalFailedReqeusts: result.Stats.totalFailedReqeusts,
+		})
+	}
+	context.SetString(FieldServerName, results[0].ServerName)
+	context.SetInt(FieldContentSize, results[0].ContentSize)
+	return stats, nil
+}
+
+// agentArgs returns the arguments of the i-th agent, requests and
+// concurrent users are split evenly
+func agentArgs(config *Config, i int) []string {
+	last := len(config.agentArgs) - 1
+	args := append([]string(nil), config.agentArgs[:last]...)
+	if config.requests > 0 {
+		args = append(args, "-n", strconv.Itoa(split(config.requests, len(config.agents), i)))
+	}
+	args = append(args, "-c", strconv.Itoa(split(config.concurrency, len(config.agents), i)))
+
+	// agents push aggregates of their share, the tags are those of the
+	// whole benchmark and the agent tells them apart
+	if len(config.pushURLs) > 0 {
+		for _, tag := range config.tags {
+			args = append(args, "-tag", tag.Key+"="+tag.Value)
+		}
+		args = append(args, "-tag", "agent="+config.agents[i])
+	}
+	return append(args, config.agentArgs[last])
+}
+
+// split returns the i-th of n shares of total, the first ones take the rest
+func split(total, n, i int) int {
+	share := total / n
+	if i < total%n {
+		share++
+	}
+	return share
+}
+
+func runAgent(client *http.Client, addr, token string, run *agentRun) (*agentResult, error) {
+	body, err := json.Marshal(run)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := newAgentRequest(addr, "/run", token, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	result := &agentResult{}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+	if result.Stats == nil {
+		return nil, fmt.Errorf("no stats in the reply")
+	}
+	return result, nil
+}
+
+func stopAgents(client *http.Client, agents []string, token string) {
+	for _, addr := range agents {
+		request, err := newAgentRequest(addr, "/stop", token, nil)
+		if err != nil {
+			fmt.Printf("Agent %s: %s\n", addr, err)
+			continue
+		}
+		resp, err := client.Do(request)
+		if err != nil {
+			fmt.Printf("Agent %s: %s\n", addr, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+func newAgentRequest(addr, path, token string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest("POST", "http://"+addr+path, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return request, nil
+}
+
+// forwardedArgs returns the options of args, which have been parsed with
+// flags, except the excluded ones
+func forwardedArgs(flags *flag.FlagSet, args []string, excluded ...string) []string {
+	var forwarded []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		inline := strings.Index(name, "=")
+		if inline >= 0 {
+			name = name[:inline]
+		}
+
+		skip := false
+		for _, excludedName := range excluded {
+			if name == excludedName {
+				skip = true
+			}
+		}
+		if !skip {
+			forwarded = append(forwarded, arg)
+		}
+
+		// the value of an option is the next argument unless it is a
+		// boolean or given inline
+		if f := flags.Lookup(name); f != nil && inline < 0 && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			if !skip {
+				forwarded = append(forwarded, args[i])
+			}
+		}
+	}
+	return forwarded
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
+
+// statsJSON is the form Stats are sent in by agents
+type statsJSON struct {
+	ResponseTimes Histogram `json:"responseTimes"`
+
+	TotalRequests       int            `json:"totalRequests"`
+	TotalExecutionTime  time.Duration  `json:"totalExecutionTime"`
+	TotalResponseTime   time.Duration  `json:"totalResponseTime"`
+	TotalReceived       int64          `json:"totalReceived"`
+	TotalSent           int64          `json:"totalSent"`
+	TotalTransferred    int64          `json:"totalTransferred"`
+	TotalWireSent       int64          `json:"totalWireSent"`
+	TotalDecoded        int64          `json:"totalDecoded"`
+	TotalDecodeTime     time.Duration  `json:"totalDecodeTime"`
+	Encodings           map[string]int `json:"encodings,omitempty"`
+	TotalFailedRequests int            `json:"totalFailedRequests"`
+
+	ProxyConnects Histogram      `json:"proxyConnects"`
+	TCPInfo       *tcpInfoJSON   `json:"tcpInfo,omitempty"`
+	TLSHandshakes Histogram      `json:"tlsHandshakes"`
+	TLSResumed    int            `json:"tlsResumed"`
+	Upgrades      Histogram      `json:"upgrades"`
+	GRPCStatuses  map[string]int `json:"grpcStatuses,omitempty"`
+	TotalEvents   int            `json:"totalEvents"`
+	FirstEvents   Histogram      `json:"firstEvents"`
+	EventGaps     Histogram      `json:"eventGaps"`
+	Protocols     map[string]int `json:"protocols,omitempty"`
+	StatusCodes   map[string]int `json:"statusCodes,omitempty"`
+
+	Interrupted     bool `json:"interrupted"`
+	DrainedRequests int  `json:"drainedRequests"`
+	AbortedRequests int  `json:"abortedRequests"`
+
+	ErrLength    int `json:"errLength"`
+	ErrConnect   int `json:"errConnect"`
+	ErrPorts     int `json:"errPorts"`
+	ErrReceive   int `json:"errReceive"`
+	ErrException int `json:"errException"`
+	ErrResponse  int `json:"errResponse"`
+	ErrExtract   int `json:"errExtract"`
+
+	Steps     []*requestStatsJSON          `json:"steps,omitempty"`
+	Addresses map[string]*requestStatsJSON `json:"addresses,omitempty"`
+	Timeline  []*requestStatsJSON          `json:"timeline,omitempty"`
+}
+
+type tcpInfoJSON struct {
+	RTT         Histogram     `json:"rtt"`
+	SumOfRTTVar time.Duration `json:"sumOfRTTVar"`
+	MinCwnd     int           `json:"minCwnd"`
+	SumOfCwnd   int           `json:"sumOfCwnd"`
+	Retransmits int           `json:"retransmits"`
+}
+
+// requestStatsJSON is the form of StepStats, AddressStats and SecondStats
+type requestStatsJSON struct {
+	Name                string    `json:"name,omitempty"`
+	ResponseTimes       Histogram `json:"responseTimes"`
+	TotalRequests       int       `json:"totalRequests"`
+	TotalFailedRequests int       `json:"totalFailedRequests"`
+}
+
+func (s *Stats) MarshalJSON() ([]byte, error) {
+	v := &statsJSON{
+		s.responseTimes,
+		s.totalRequests, s.totalExecutionTime, s.totalResponseTime, s.totalReceived, s.totalSent, s.totalTransferred,
+		s.totalWireSent, s.totalDecoded, s.totalDecodeTime, s.encodings, s.totalFailedReqeusts,
+		s.proxyConnects, nil, s.tlsHandshakes, s.tlsResumed, s.upgrades, s.grpcStatuses, s.totalEvents,
+		s.firstEvents, s.eventGaps, s.protocols, s.statusCodes,
+		s.interrupted, s.drainedRequests, s.abortedRequests,
+		s.errLength, s.errConnect, s.errPorts, s.errReceive, s.errException, s.errResponse, s.errExtract,
+		nil, nil, nil,
+	}
+	if s.tcpInfo != nil {
+		v.TCPInfo = &tcpInfoJSON{s.tcpInfo.rtt, s.tcpInfo.sumOfRTTVar, s.tcpInfo.minCwnd, s.tcpInfo.sumOfCwnd, s.tcpInfo.retransmits}
+	}
+	for _, step := range s.steps {
+		v.Steps = append(v.Steps, &requestStatsJSON{step.name, step.responseTimes, step.totalRequests, step.totalFailedReqeusts})
+	}
+	if len(s.addresses) > 0 {
+		v.Addresses = make(map[string]*requestStatsJSON)
+		for address, addressStats := range s.addresses {
+			v.Addresses[address] = &requestStatsJSON{"", addressStats.responseTimes, addressStats.totalRequests, addressStats.totalFailedReqeusts}
+		}
+	}
+	for _, secondStats := range s.timeline {
+		v.Timeline = append(v.Timeline, &requestStatsJSON{"", secondStats.responseTimes, secondStats.totalRequests, secondStats.totalFailedReqeusts})
+	}
+	return json.Marshal(v)
+}
+
+func (s *Stats) UnmarshalJSON(data []byte) error {
+	v := &statsJSON{}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	*s = Stats{
+		responseTimes:       v.ResponseTimes,
+		totalRequests:       v.TotalRequests,
+		totalExecutionTime:  v.TotalExecutionTime,
+		totalResponseTime:   v.TotalResponseTime,
+		totalReceived:       v.TotalReceived,
+		totalSent:           v.TotalSent,
+		totalTransferred:    v.TotalTransferred,
+		totalWireSent:       v.TotalWireSent,
+		totalDecoded:        v.TotalDecoded,
+		totalDecodeTime:     v.TotalDecodeTime,
+		encodings:           v.Encodings,
+		totalFailedReqeusts: v.TotalFailedRequests,
+		proxyConnects:       v.ProxyConnects,
+		tlsHandshakes:       v.TLSHandshakes,
+		tlsResumed:          v.TLSResumed,
+		upgrades:            v.Upgrades,
+		grpcStatuses:        v.GRPCStatuses,
+		totalEvents:         v.TotalEvents,
+		firstEvents:         v.FirstEvents,
+		eventGaps:           v.EventGaps,
+		protocols:           v.Protocols,
+		statusCodes:         v.StatusCodes,
+		interrupted:         v.Interrupted,
+		drainedRequests:     v.DrainedRequests,
+		abortedRequests:     v.AbortedRequests,
+		errLength:           v.ErrLength,
+		errConnect:          v.ErrConnect,
+		errPorts:            v.ErrPorts,
+		errReceive:          v.ErrReceive,
+		errException:        v.ErrException,
+		errResponse:         v.ErrResponse,
+		errExtract:          v.ErrExtract,
+	}
+	if v.TCPInfo != nil {
+		s.tcpInfo = &TCPInfoStats{
+			rtt:         v.TCPInfo.RTT,
+			sumOfRTTVar: v.TCPInfo.SumOfRTTVar,
+			minCwnd:     v.TCPInfo.MinCwnd,
+			sumOfCwnd:   v.TCPInfo.SumOfCwnd,
+			retransmits: v.TCPInfo.Retransmits,
+		}
+	}
+	for _, step := range v.Steps {
+		s.steps = append(s.steps, &StepStats{step.Name, step.ResponseTimes, step.TotalRequests, step.TotalFailedRequests})
+	}
+	for address, addressStats := range v.Addresses {
+		if s.addresses == nil {
+			s.addresses = make(map[string]*AddressStats)
+		}
+		s.addresses[address] = &AddressStats{addressStats.ResponseTimes, addressStats.TotalRequests, addressStats.TotalFailedRequests}
+	}
+	for _, secondStats := range v.Timeline {
+		s.timeline = append(s.timeline, &SecondStats{secondStats.ResponseTimes, secondStats.TotalRequests, secondStats.TotalFailedRequests})
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestConfig(t *testing.T, args ...string) *Config {
+	flags := flag.NewFlagSet("gb", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	config, err := ParseConfig(flags, args)
+	if err != nil {
+		t.Fatalf("expected %q to parse, got %s", args, err)
+	}
+	return config
+}
+
+func TestAgentArgs(t *testing.T) {
+	config := parseTestConfig(t, "-k", "-agents", "a:7070,b:7070,c:7070", "-H", "X-Test: 1", "-n", "10", "-agent-delay=1s", "-agent-token", "secret", "-c", "4", "-html", "report.html", "--", "http://localhost/")
+
+	expected := [][]string{
+		{"-k", "-H", "X-Test: 1", "-n", "10", "-c", "4", "-n", "4", "-c", "2", "http://localhost/"},
+		{"-k", "-H", "X-Test: 1", "-n", "10", "-c", "4", "-n", "3", "-c", "1", "http://localhost/"},
+		{"-k", "-H", "X-Test: 1", "-n", "10", "-c", "4", "-n", "3", "-c", "1", "http://localhost/"},
+	}
+	for i := range config.agents {
+		if args := agentArgs(config, i); !reflect.DeepEqual(args, expected[i]) {
+			t.Errorf("expected %q for agent %d, got %q", expected[i], i, args)
+		}
+	}
+
+	// time limited runs are split by concurrent users only
+	config = parseTestConfig(t, "-agents", "a:7070,b:7070", "-agent-token=secret", "-t", "5", "-c", "2", "http://localhost/")
+	if args := agentArgs(config, 1); !reflect.DeepEqual(args, []string{"-t", "5", "-c", "2", "-c", "1", "http://localhost/"}) {
+		t.Errorf("expected no number of requests, got %q", args)
+	}
+
+	// pushed aggregates are tagged with the concurrency of the run and the agent
+	config = parseTestConfig(t, "-agents", "a:7070,b:7070", "-agent-token=secret", "-n", "4", "-c", "2", "-push", "statsd://localhost:8125", "-tag", "commit=4f2a9c1", "http://localhost/")
+	expected[0] = []string{"-n", "4", "-c", "2", "-push", "statsd://localhost:8125", "-tag", "commit=4f2a9c1", "-n", "2", "-c", "1",
+		"-tag", "url=http://localhost/", "-tag", "concurrency=2", "-tag", "commit=4f2a9c1", "-tag", "agent=b:7070", "http://localhost/"}
+	if args := agentArgs(config, 1); !reflect.DeepEqual(args, expected[0]) {
+		t.Errorf("expected %q, got %q", expected[0], args)
+	}
+	agent := parseTestConfig(t, agentArgs(config, 1)...)
+	if !reflect.DeepEqual(agent.tags, []Tag{{"url", "http://localhost/"}, {"concurrency", "2"}, {"commit", "4f2a9c1"}, {"agent", "b:7070"}}) {
+		t.Errorf("expected the tags of the run, got %+v", agent.tags)
+	}
+}
+
+func TestDistribute(t *testing.T) {
+	responseStr := "hello"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "test")
+		w.Write([]byte(responseStr))
+	}))
+	defer ts.Close()
+
+	var agents []string
+	for i := 0; i < 2; i++ {
+		agent := httptest.NewServer(NewAgent(&Config{agentToken: "secret"}, nil))
+		defer agent.Close()
+		agents = append(agents, strings.TrimPrefix(agent.URL, "http://"))
+	}
+
+	config := parseTestConfig(t, "-agents", strings.Join(agents, ","), "-agent-delay", "100ms", "-agent-token", "secret", "-n", "5", "-c", "2", "-k", ts.URL)
+	context := NewContext(config)
+
+	devnull, _ := os.Open(os.DevNull)
+	defer devnull.Close()
+	stdout := os.Stdout
+	os.Stdout = devnull
+
+	stats, err := Distribute(context)
+
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.totalRequests != 5 || stats.totalFailedReqeusts != 0 || stats.responseTimes.Count() != 5 {
+		t.Fatalf("expected 5 successful requests, got %d with %d failed", stats.totalRequests, stats.totalFailedReqeusts)
+	}
+	if stats.totalReceived != int64(5*len(responseStr)) {
+		t.Fatalf("expected %d bytes received, got %d", 5*len(responseStr), stats.totalReceived)
+	}
+	if len(stats.agents) != 2 || stats.agents[0].totalRequests != 3 || stats.agents[1].totalRequests != 2 {
+		t.Fatalf("expected 3 and 2 requests of the agents, got %+v", stats.agents)
+	}
+	if context.GetString(FieldServerName) != "test" || context.GetInt(FieldContentSize) != len(responseStr) {
+		t.Fatalf("expected the server detected by the agents, got %q and %d", context.GetString(FieldServerName), context.GetInt(FieldContentSize))
+	}
+}
+
+func TestDistributeWithFailedAgent(t *testing.T) {
+	agent := httptest.NewServer(NewAgent(&Config{agentToken: "secret", agentAllowFiles: true}, nil))
+	defer agent.Close()
+
+	// the agent cannot read the file, which was there for the coordinator
+	body, err := ioutil.TempFile("", "gb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+	config := parseTestConfig(t, "-agents", strings.TrimPrefix(agent.URL, "http://"), "-agent-token", "secret", "-p", body.Name(), "http://localhost/")
+	os.Remove(body.Name())
+
+	devnull, _ := os.Open(os.DevNull)
+	defer devnull.Close()
+	stdout := os.Stdout
+	os.Stdout = devnull
+
+	_, err = Distribute(NewContext(config))
+
+	os.Stdout = stdout
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request") {
+		t.Fatalf("expected the agent to reject the benchmark, got %v", err)
+	}
+}
+
+func TestAgentRejectsRuns(t *testing.T) {
+	agent := httptest.NewServer(NewAgent(&Config{agentToken: "secret"}, nil))
+	defer agent.Close()
+	addr := strings.TrimPrefix(agent.URL, "http://")
+
+	testData := []struct {
+		token    string
+		args     []string
+		expected string
+	}{
+		{"", []string{"-n", "1", "http://localhost/"}, "401 Unauthorized"},
+		{"guess", []string{"-n", "1", "http://localhost/"}, "401 Unauthorized"},
+		// options reading files of the agent need -agent-allow-files
+		{"secret", []string{"-d", "@/etc/passwd", "http://localhost/"}, "Cannot use -d @file"},
+		{"secret", []string{"-F", "a=1", "-F", "file=@/etc/passwd", "http://localhost/"}, "Cannot use -F name=@file"},
+		{"secret", []string{"-scenario", "testdata/scenario.json", "-unix-socket", "/var/run/app.sock", "http://localhost/"}, "Cannot use -scenario, -unix-socket"},
+	}
+	for _, data := range testData {
+		_, err := runAgent(&http.Client{}, addr, data.token, &agentRun{Args: data.args})
+		if err == nil || !strings.Contains(err.Error(), data.expected) {
+			t.Errorf("expected %q for %q with token %q, got %v", data.expected, data.args, data.token, err)
+		}
+	}
+
+	for _, args := range [][]string{{"-agent", ":7070"}, {"-agents", "a:7070", "http://localhost/"}} {
+		flags := flag.NewFlagSet("gb", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		if _, err := ParseConfig(flags, args); err == nil || !strings.Contains(err.Error(), "-agent-token") {
+			t.Errorf("expected %q to require a token, got %v", args, err)
+		}
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	stats := &Stats{
+		totalRequests:      3,
+		totalExecutionTime: time.Second,
+		encodings:          map[string]int{"gzip": 2},
+		tcpInfo:            &TCPInfoStats{},
+		errConnect:         1,
+		steps:              []*StepStats{{name: "login", totalRequests: 3}},
+		addresses:          map[string]*AddressStats{"127.0.0.1": {totalRequests: 3}},
+		statusCodes:        map[string]int{"200": 2},
+		timeline:           []*SecondStats{{totalRequests: 1}, {totalRequests: 2, totalFailedReqeusts: 1}},
+	}
+	stats.responseTimes.Record(time.Millisecond)
+	stats.tcpInfo.Add(&TCPInfo{RTT: time.Millisecond, Cwnd: 10})
+	stats.steps[0].responseTimes.Record(time.Millisecond)
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Stats{}
+	if err = json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.totalRequests != 3 || decoded.totalExecutionTime != time.Second || decoded.encodings["gzip"] != 2 || decoded.errConnect != 1 ||
+		decoded.responseTimes.Max() != time.Millisecond || decoded.tcpInfo.minCwnd != 10 ||
+		decoded.steps[0].name != "login" || decoded.steps[0].responseTimes.Count() != 1 || decoded.addresses["127.0.0.1"].totalRequests != 3 ||
+		decoded.statusCodes["200"] != 2 || len(decoded.timeline) != 2 || decoded.timeline[1].totalFailedReqeusts != 1 {
+		t.Fatalf("expected %s to decode to the stats", data)
+	}
+}
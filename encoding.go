@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	AcceptEncoding = "gzip, deflate"
+)
+
+// contentDecoders decode response bodies by Content-Encoding. br and zstd
+// are not decoded: the standard library has no decoders for them and gb
+// takes no dependencies, such responses are counted on the wire only and
+// reported as not decoded
+var contentDecoders = map[string]func(io.Reader) (io.Reader, error){
+	"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	"x-gzip":  func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	"deflate": newDeflateReader,
+}
+
+// newDeflateReader reads zlib wrapped deflate as RFC 9110 specifies, and
+// the raw deflate some servers send instead
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// EncodeBody compresses a request body to be sent with Content-Encoding
+func EncodeBody(encoding string, content []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(&buffer)
+	case "deflate":
+		writer = zlib.NewWriter(&buffer)
+	default:
+		return nil, fmt.Errorf("unsupported body encoding %q, must be gzip or deflate", encoding)
+	}
+
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// TimedReader counts the bytes read from the wire and the time spent
+// waiting for them, so decoding cost can be told apart
+type TimedReader struct {
+	r       io.Reader
+	n       int64
+	elapsed time.Duration
+}
+
+func (t *TimedReader) Read(p []byte) (n int, err error) {
+	start := time.Now()
+	n, err = t.r.Read(p)
+	t.elapsed += time.Since(start)
+	t.n += int64(n)
+	return
+}
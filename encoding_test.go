@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeBody(t *testing.T) {
+	content := []byte(strings.Repeat("hello", 100))
+
+	encoded, err := EncodeBody("gzip", content)
+	if err != nil {
+		t.Fatalf("encode body failed: %s", err)
+	}
+	reader, _ := gzip.NewReader(bytes.NewReader(encoded))
+	if decoded, _ := ioutil.ReadAll(reader); !bytes.Equal(decoded, content) {
+		t.Fatal("expected gzip body to decode to the content")
+	}
+
+	encoded, _ = EncodeBody("deflate", content)
+	reader2, _ := zlib.NewReader(bytes.NewReader(encoded))
+	if decoded, _ := ioutil.ReadAll(reader2); !bytes.Equal(decoded, content) {
+		t.Fatal("expected deflate body to decode to the content")
+	}
+
+	if _, err := EncodeBody("br", content); err == nil {
+		t.Fatal("expected error for unsupported body encoding")
+	}
+}
+
+func TestHTTPWithCompressedResponse(t *testing.T) {
+	content := []byte(strings.Repeat("hello", 1000))
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(content)
+	writer.Close()
+
+	var raw bytes.Buffer
+	rawWriter, _ := flate.NewWriter(&raw, flate.DefaultCompression)
+	rawWriter.Write(content)
+	rawWriter.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Accept-Encoding") != AcceptEncoding:
+			w.WriteHeader(http.StatusBadRequest)
+		case r.URL.Path == "/br":
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte("not really brotli"))
+		case r.URL.Path == "/deflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			w.Write(raw.Bytes())
+		case r.URL.Path == "/empty":
+			w.Header().Set("Content-Encoding", "gzip")
+		case r.URL.Path == "/slow":
+			// the body is late, waiting for it is no decoding time
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+			w.Write(compressed.Bytes())
+		case r.URL.Path == "/no-content":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed.Bytes())
+		}
+	}))
+	defer ts.Close()
+
+	// bodiless responses are not decoded whatever their Content-Encoding
+	testData := []struct {
+		method   string
+		path     string
+		expected [2]int
+	}{
+		{"GET", "/", [2]int{compressed.Len(), len(content)}},
+		{"GET", "/br", [2]int{17, 17}},
+		{"GET", "/deflate", [2]int{raw.Len(), len(content)}},
+		{"GET", "/empty", [2]int{0, 0}},
+		{"GET", "/slow", [2]int{compressed.Len(), len(content)}},
+		{"GET", "/no-content", [2]int{0, 0}},
+		{"HEAD", "/", [2]int{0, 0}},
+	}
+	for _, data := range testData {
+		path, expected := data.path, data.expected
+		config := &Config{
+			concurrency:      1,
+			requests:         1,
+			method:           data.method,
+			gzip:             true,
+			executionTimeout: MaxExecutionTimeout,
+			url:              ts.URL + path,
+		}
+
+		context := NewContext(config)
+		context.SetInt(FieldContentSize, compressed.Len())
+		jobs := make(chan *Job)
+		collector := make(chan *Record)
+
+		go NewHTTPWorker(context, 1, jobs, collector).Run()
+
+		request, _ := NewHTTPRequest(context.work, config)
+		jobs <- &Job{request: request}
+		record := <-collector
+		close(jobs)
+		context.abort()
+
+		if record.Error != nil {
+			t.Fatalf("sent a %s reqeust to %s but was error: %s", data.method, path, record.Error)
+		}
+
+		if record.contentSize != int64(expected[0]) || record.decodedSize != int64(expected[1]) {
+			t.Fatalf("expected %d bytes on the wire and %d decoded for %s, got %d and %d", expected[0], expected[1], path, record.contentSize, record.decodedSize)
+		}
+		if record.decodeTime < 0 {
+			t.Fatalf("expected a positive decoding time for %s, got %s", path, record.decodeTime)
+		}
+	}
+}
+
+func TestNewHTTPRequestWithBodyEncoding(t *testing.T) {
+	config := &Config{
+		url:          "http://localhost/",
+		method:       "POST",
+		contentType:  "text/plain",
+		bodyContent:  []byte(strings.Repeat("hello", 100)),
+		bodyEncoding: "gzip",
+	}
+
+	request, err := NewHTTPRequest(context.Background(), config)
+	if err != nil {
+		t.Fatalf("new http request failed: %s", err)
+	}
+
+	if request.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip content encoding, got %q", request.Header.Get("Content-Encoding"))
+	}
+
+	// copies carry the encoded body too
+	for _, r := range []*http.Request{request, CopyHTTPRequest(request)} {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("expected gzip body, got %s", err)
+		}
+		if decoded, _ := ioutil.ReadAll(reader); !bytes.Equal(decoded, config.bodyContent) {
+			t.Fatal("expected body to decode to the content")
+		}
+	}
+}
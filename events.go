@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	FramingSSE   = "sse"   // text/event-stream, events end with a blank line
+	FramingLines = "lines" // a line per event, eg. NDJSON
+)
+
+var (
+	ErrNoEvents = errors.New("no events received")
+)
+
+// EventReader splits a streamed response into events and times them from
+// the start of the request
+type EventReader struct {
+	reader  *bufio.Reader
+	framing string
+	start   time.Time
+
+	events     int
+	firstEvent time.Duration
+	eventGaps  []time.Duration
+	last       time.Time
+}
+
+func NewEventReader(r io.Reader, framing string, start time.Time) *EventReader {
+	return &EventReader{reader: bufio.NewReader(r), framing: framing, start: start}
+}
+
+// ParseFraming validates the framing of streamed events
+func ParseFraming(framing string) (string, error) {
+	switch framing {
+	case FramingSSE, FramingLines:
+		return framing, nil
+	}
+	return "", fmt.Errorf("unsupported framing %q, must be sse or lines", framing)
+}
+
+// ReadFrom reads events until the end of the stream or an error, it returns
+// the number of bytes read
+func (e *EventReader) ReadFrom() (n int64, err error) {
+	pending := false // an sse event has fields but wasn't dispatched yet
+	for {
+		line, err := e.reader.ReadSlice('\n')
+		n += int64(len(line))
+		if err == bufio.ErrBufferFull {
+			// long lines are read in parts, only their end matters
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				// an unterminated sse event is discarded like browsers do
+				if e.framing == FramingLines && len(bytes.TrimSpace(line)) > 0 {
+					e.event()
+				}
+				return n, nil
+			}
+			return n, err
+		}
+
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case e.framing == FramingLines:
+			if len(line) > 0 {
+				e.event()
+			}
+		case len(line) == 0:
+			if pending {
+				e.event()
+				pending = false
+			}
+		case line[0] != ':': // comments keep connections alive
+			pending = true
+		}
+	}
+}
+
+func (e *EventReader) event() {
+	now := time.Now()
+	if e.events == 0 {
+		e.firstEvent = now.Sub(e.start)
+	} else {
+		e.eventGaps = append(e.eventGaps, now.Sub(e.last))
+	}
+	e.last = now
+	e.events++
+}
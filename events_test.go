@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventReader(t *testing.T) {
+	testData := []struct {
+		framing string
+		stream  string
+		events  int
+	}{
+		{FramingSSE, "data: a\n\ndata: b\ndata: c\n\n", 2},
+		{FramingSSE, ": keepalive\n\nevent: tick\r\ndata: 1\r\n\r\n", 1},
+		{FramingSSE, "data: a\n\ndata: b", 1},
+		{FramingSSE, "\n\n\n", 0},
+		{FramingLines, "{\"a\":1}\n{\"a\":2}\n\n{\"a\":3}", 3},
+	}
+
+	for _, data := range testData {
+		events := NewEventReader(strings.NewReader(data.stream), data.framing, time.Now())
+		n, err := events.ReadFrom()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(data.stream)) {
+			t.Fatalf("expected %d bytes read, got %d", len(data.stream), n)
+		}
+		if events.events != data.events {
+			t.Fatalf("expected %d %s events in %q, got %d", data.events, data.framing, data.stream, events.events)
+		}
+		if data.events > 0 && len(events.eventGaps) != data.events-1 {
+			t.Fatalf("expected %d gaps between events, got %d", data.events-1, len(events.eventGaps))
+		}
+	}
+
+	if _, err := ParseFraming("xml"); err == nil {
+		t.Fatal("expected an error for an unsupported framing")
+	}
+}
+
+func TestHTTPWithServerSentEvents(t *testing.T) {
+	interval := 20 * time.Millisecond
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: tick\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-time.After(interval):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      2,
+		requests:         2,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+		sse:              10 * interval,
+		sseFraming:       FramingSSE,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 0)
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	for record := range benchmark.collector {
+		if record.Error != nil {
+			t.Fatalf("held a streamed response but was error: %s", record.Error)
+		}
+		// held for the duration, the first event is sent right away
+		if record.responseTime < config.sse || record.firstEvent >= interval {
+			t.Fatalf("expected to be held %s with the first event right away, got %s and %s", config.sse, record.responseTime, record.firstEvent)
+		}
+		if record.events < 5 || len(record.eventGaps) != record.events-1 {
+			t.Fatalf("expected about 10 events and their gaps, got %d events and %d gaps", record.events, len(record.eventGaps))
+		}
+	}
+	context.abort()
+}
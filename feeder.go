@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	FeedSequential = "sequential"
+	FeedRandom     = "random"
+	FeedUnique     = "unique"
+)
+
+var (
+	ErrEmptyDataFile       = errors.New("data file has no rows")
+	ErrInvalidFeedStrategy = errors.New("invalid data strategy, must be one of sequential, random or unique")
+)
+
+// Feeder assigns rows of a data file to jobs, it is used by the job
+// production loop only and is not safe for concurrent use
+type Feeder struct {
+	rows     []map[string]string
+	strategy string
+	next     int
+}
+
+// NewFeeder loads a csv or jsonl (one object per line) data file, columns
+// names the csv columns, the first row names them when columns is empty
+func NewFeeder(filename string, columns []string, strategy string) (feeder *Feeder, err error) {
+	switch strategy {
+	case FeedSequential, FeedRandom, FeedUnique:
+	default:
+		err = ErrInvalidFeedStrategy
+		return
+	}
+
+	var rows []map[string]string
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jsonl", ".json", ".ndjson":
+		rows, err = loadJSONLines(filename)
+	default:
+		rows, err = loadCSV(filename, columns)
+	}
+	if err != nil {
+		return
+	}
+
+	if len(rows) == 0 {
+		err = ErrEmptyDataFile
+		return
+	}
+
+	return &Feeder{rows: rows, strategy: strategy}, nil
+}
+
+// Next returns the row for the next job, ok is false once a unique feeder
+// is exhausted
+func (f *Feeder) Next() (row map[string]string, ok bool) {
+	switch f.strategy {
+	case FeedRandom:
+		return f.rows[rand.Intn(len(f.rows))], true
+	case FeedUnique:
+		if f.next >= len(f.rows) {
+			return nil, false
+		}
+	}
+
+	row = f.rows[f.next%len(f.rows)]
+	f.next++
+	return row, true
+}
+
+func loadCSV(filename string, columns []string) (rows []map[string]string, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return
+	}
+
+	if len(columns) == 0 && len(records) > 0 {
+		columns, records = records[0], records[1:]
+	}
+
+	for n, record := range records {
+		if len(record) < len(columns) {
+			err = fmt.Errorf("%s:%d: expected %d columns, got %d", filename, n+1, len(columns), len(record))
+			return
+		}
+
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+func loadJSONLines(filename string) (rows []map[string]string, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, MaxBufferSize), 1024*1024)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var object map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		if err = decoder.Decode(&object); err != nil {
+			err = fmt.Errorf("%s:%d: %s", filename, n, err)
+			return
+		}
+
+		row := make(map[string]string, len(object))
+		for key, value := range object {
+			switch v := value.(type) {
+			case string:
+				row[key] = v
+			case nil:
+				row[key] = ""
+			default:
+				// numbers, booleans and nested values keep their json encoding
+				encoded, _ := json.Marshal(v)
+				row[key] = string(encoded)
+			}
+		}
+		rows = append(rows, row)
+	}
+	err = scanner.Err()
+	return
+}
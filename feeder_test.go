@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFeederWithCSV(t *testing.T) {
+	feeder, err := NewFeeder("testdata/data.csv", nil, FeedSequential)
+	if err != nil {
+		t.Fatalf("load data file failed: %s", err)
+	}
+
+	expected := []string{"alice", "bob", "carol", "alice"}
+	for _, name := range expected {
+		if row, ok := feeder.Next(); !ok || row["name"] != name {
+			t.Fatalf("expected %s, got %v", name, row)
+		}
+	}
+}
+
+func TestFeederWithColumns(t *testing.T) {
+	feeder, err := NewFeeder("testdata/data_noheader.csv", []string{"id", "name"}, FeedSequential)
+	if err != nil {
+		t.Fatalf("load data file failed: %s", err)
+	}
+
+	if row, _ := feeder.Next(); row["id"] != "7" || row["name"] != "g" {
+		t.Fatalf("unexpected row %v", row)
+	}
+}
+
+func TestFeederWithJSONLines(t *testing.T) {
+	feeder, err := NewFeeder("testdata/data.jsonl", nil, FeedSequential)
+	if err != nil {
+		t.Fatalf("load data file failed: %s", err)
+	}
+
+	if len(feeder.rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(feeder.rows))
+	}
+
+	if row, _ := feeder.Next(); row["id"] != "1" || row["token"] != "a1" || row["admin"] != "true" {
+		t.Fatalf("unexpected row %v", row)
+	}
+}
+
+func TestFeederWithUnique(t *testing.T) {
+	feeder, _ := NewFeeder("testdata/data.csv", nil, FeedUnique)
+
+	for i := 0; i < 3; i++ {
+		if _, ok := feeder.Next(); !ok {
+			t.Fatalf("expected row %d", i+1)
+		}
+	}
+
+	if _, ok := feeder.Next(); ok {
+		t.Fatal("expected unique feeder to be exhausted")
+	}
+}
+
+func TestFeederWithRandom(t *testing.T) {
+	feeder, _ := NewFeeder("testdata/data.csv", nil, FeedRandom)
+
+	for i := 0; i < 10; i++ {
+		if row, ok := feeder.Next(); !ok || row["name"] == "" {
+			t.Fatalf("expected a row, got %v", row)
+		}
+	}
+}
+
+func TestFeederWithInvalidStrategy(t *testing.T) {
+	if _, err := NewFeeder("testdata/data.csv", nil, "shuffle"); err != ErrInvalidFeedStrategy {
+		t.Fatalf("expected %s, got %v", ErrInvalidFeedStrategy, err)
+	}
+}
+
+func TestBenchmarkWithUniqueFeeder(t *testing.T) {
+
+	var received int64
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&received, 1)
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         10,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL + "/{{.Data.id}}",
+	}
+	config.feeder, _ = NewFeeder("testdata/data.csv", nil, FeedUnique)
+	config.template, _ = NewRequestTemplate(config)
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+	for range benchmark.collector {
+	}
+	context.abort()
+
+	if actualReceived := atomic.LoadInt64(&received); actualReceived != 3 {
+		t.Fatalf("expected to stop after 3 unique rows, got %d requests", actualReceived)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Form builds a multipart/form-data or an application/x-www-form-urlencoded
+// request body from fields
+type Form struct {
+	multipart bool
+	boundary  string
+	fields    []*FormField
+}
+
+// FormField is 'name=value' or 'name=@file' for a file upload
+type FormField struct {
+	name     string
+	value    string
+	filename string
+	content  []byte
+}
+
+func NewForm(multipartFields []string, urlencodedFields []string) (form *Form, err error) {
+	if len(multipartFields) > 0 && len(urlencodedFields) > 0 {
+		return nil, fmt.Errorf("Cannot use multipart and url-encoded form fields together")
+	}
+
+	form = &Form{multipart: len(multipartFields) > 0}
+	for _, field := range append(multipartFields, urlencodedFields...) {
+		var formField *FormField
+		if formField, err = ParseFormField(field, form.multipart); err != nil {
+			return
+		}
+		form.fields = append(form.fields, formField)
+	}
+
+	if form.multipart {
+		form.boundary = multipart.NewWriter(ioutil.Discard).Boundary()
+	}
+	return
+}
+
+// ParseFormField splits the field on the first equals sign, files are only
+// read for multipart forms
+func ParseFormField(field string, multipart bool) (formField *FormField, err error) {
+	pos := strings.Index(field, "=")
+	if pos <= 0 {
+		return nil, fmt.Errorf("invalid form field %q, expected 'name=value'", field)
+	}
+
+	formField = &FormField{name: field[:pos], value: field[pos+1:]}
+	if multipart && strings.HasPrefix(formField.value, "@") {
+		formField.filename = formField.value[1:]
+		formField.value = ""
+		if formField.content, err = ioutil.ReadFile(formField.filename); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func (f *Form) ContentType() string {
+	if f.multipart {
+		return "multipart/form-data; boundary=" + f.boundary
+	}
+	return "application/x-www-form-urlencoded"
+}
+
+func (f *Form) Encode() ([]byte, error) {
+	if !f.multipart {
+		values := url.Values{}
+		for _, field := range f.fields {
+			values.Add(field.name, field.value)
+		}
+		return []byte(values.Encode()), nil
+	}
+
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+	if err := writer.SetBoundary(f.boundary); err != nil {
+		return nil, err
+	}
+
+	for _, field := range f.fields {
+		if field.filename == "" {
+			if err := writer.WriteField(field.name, field.value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(field.filename))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(field.name), escapeQuotes(filepath.Base(field.filename))))
+		header.Set("Content-Type", contentType)
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = part.Write(field.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestURLEncodedForm(t *testing.T) {
+	form, err := NewForm(nil, []string{"email=test@example.com", "q=a=b&c"})
+	if err != nil {
+		t.Fatalf("new form failed: %s", err)
+	}
+
+	body, _ := form.Encode()
+	if expected := "email=test%40example.com&q=a%3Db%26c"; string(body) != expected {
+		t.Fatalf("expected %s, got %s", expected, body)
+	}
+
+	if form.ContentType() != "application/x-www-form-urlencoded" {
+		t.Fatalf("unexpected content type %s", form.ContentType())
+	}
+}
+
+func TestNewFormWithInvalidFields(t *testing.T) {
+	testData := [][2][]string{
+		{{"novalue"}, nil},
+		{nil, {"=value"}},
+		{{"file=@testdata/missing.txt"}, nil},
+		{{"a=b"}, {"c=d"}},
+	}
+
+	for _, testingData := range testData {
+		if _, err := NewForm(testingData[0], testingData[1]); err == nil {
+			t.Errorf("expected error for %v", testingData)
+		}
+	}
+}
+
+func TestHTTPWithMultipartForm(t *testing.T) {
+	expectedFile, _ := ioutil.ReadFile("testdata/postfile.txt")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		file, header, err := r.FormFile("upload")
+		if err != nil || header.Filename != "postfile.txt" || header.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		content, _ := ioutil.ReadAll(file)
+
+		if r.FormValue("name") != "gb-1" || string(content) != string(expectedFile) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		url:              ts.URL,
+		method:           "POST",
+		contentType:      "text/plain",
+		executionTimeout: MaxExecutionTimeout,
+	}
+
+	var err error
+	if config.form, err = NewForm([]string{"name=gb-{{.Seq}}", "upload=@testdata/postfile.txt"}, nil); err != nil {
+		t.Fatalf("new form failed: %s", err)
+	}
+	config.bodyContent, _ = config.form.Encode()
+	config.template, _ = NewRequestTemplate(config)
+
+	request, err := config.template.Render(context.Background(), &TemplateVars{Seq: 1})
+	if err != nil {
+		t.Fatalf("render template failed: %s", err)
+	}
+
+	if request.Header.Get("Content-Type") != config.form.ContentType() {
+		t.Fatalf("expected %s, got %s", config.form.ContentType(), request.Header.Get("Content-Type"))
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("send request failed: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected multipart form to be accepted, got %s", resp.Status)
+	}
+}
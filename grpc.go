@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// grpcStatusNames are the names of the gRPC status codes
+var grpcStatusNames = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+const (
+	GRPCContentType = "application/grpc"
+	grpcUnknown     = 2
+)
+
+func grpcStatusName(code int) string {
+	if code >= 0 && code < len(grpcStatusNames) {
+		return grpcStatusNames[code]
+	}
+	return strconv.Itoa(code)
+}
+
+// LoadGRPC sets up config for unary calls of method, eg.
+// 'package.Service/Method', with the request message in JSON. The request
+// is encoded once with the descriptor set and sent over HTTP/2
+func LoadGRPC(config *Config, descriptorSet string, method string, message []byte) error {
+	descriptors, err := LoadDescriptorSet(descriptorSet)
+	if err != nil {
+		return err
+	}
+
+	protoMethod, ok := descriptors.methods[method]
+	if !ok {
+		return fmt.Errorf("method %s not found in the descriptor set", method)
+	}
+	if protoMethod.streaming {
+		return fmt.Errorf("method %s is streaming, only unary methods are supported", method)
+	}
+
+	if message == nil {
+		message = []byte("{}")
+	}
+	encoded, err := descriptors.EncodeJSON(protoMethod.input, message)
+	if err != nil {
+		return err
+	}
+
+	URL, err := url.Parse(config.url)
+	if err != nil {
+		return err
+	}
+	URL.Path, URL.RawQuery = "/"+method, ""
+
+	config.url = URL.String()
+	config.grpcMethod = method
+	config.method = "POST"
+	config.bodyContent = grpcFrame(encoded)
+	config.contentType = GRPCContentType
+	config.headers = append([]string{"TE: trailers"}, config.headers...)
+	config.protocol = ProtocolHTTP2
+	return nil
+}
+
+// grpcFrame prefixes an uncompressed message with its length
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// grpcStatus returns the status of a read response, from the trailers or
+// from the headers of a trailers-only response
+func grpcStatus(resp *http.Response) (code int, message string) {
+	status := resp.Trailer.Get("Grpc-Status")
+	message = resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return grpcUnknown, "missing grpc-status"
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	return code, message
+}
+
+// GRPCError is a call that completed with a status other than OK
+type GRPCError struct {
+	code int
+	err  error
+}
+
+func (e *GRPCError) Error() string {
+	return grpcStatusName(e.code) + ": " + e.err.Error()
+}
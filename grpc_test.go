@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// greeter answers test.Greeter/SayHello, names other than 'gb' are not found
+func greeter(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != GRPCContentType || r.URL.Path != "/test.Greeter/SayHello" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r.Body, header); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	message := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(r.Body, message); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var name string
+	readProtoFields(message, func(number, wireType int, value uint64, bytes []byte) error {
+		if number == 1 {
+			name = string(bytes)
+		}
+		return nil
+	})
+
+	w.Header().Set("Content-Type", GRPCContentType)
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	if name != "gb" {
+		w.Header().Set("Grpc-Status", "5")
+		w.Header().Set("Grpc-Message", "no%20such%20name")
+		return
+	}
+	w.Write(grpcFrame(appendProtoBytes(nil, 1, []byte("hello "+name))))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func TestHTTPWithGRPC(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(greeter))
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "gb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	descriptorSet := filepath.Join(dir, "test.protoset")
+	if err = ioutil.WriteFile(descriptorSet, testDescriptorSet(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testData := []struct {
+		message string
+		status  string
+	}{
+		{`{"name": "gb"}`, "OK"},
+		{`{"name": "ab"}`, "NOT_FOUND"},
+	}
+
+	for _, data := range testData {
+		config := &Config{
+			concurrency:      1,
+			requests:         2,
+			executionTimeout: MaxExecutionTimeout,
+			url:              ts.URL + "/ignored?path",
+		}
+		if err = LoadGRPC(config, descriptorSet, "test.Greeter/SayHello", []byte(data.message)); err != nil {
+			t.Fatal(err)
+		}
+
+		context := NewContext(config)
+		if err = DetectHost(context); err != nil {
+			t.Fatal(err)
+		}
+		benchmark := NewBenchmark(context)
+
+		go benchmark.Run()
+
+		for record := range benchmark.collector {
+			if record.grpcStatus != data.status {
+				t.Fatalf("expected gRPC status %s, got %q (%v)", data.status, record.grpcStatus, record.Error)
+			}
+			if data.status == "OK" && record.Error != nil {
+				t.Fatalf("called a gRPC method but was error: %s", record.Error)
+			}
+			if data.status != "OK" {
+				if grpcErr, ok := record.Error.(*GRPCError); !ok || grpcErr.Error() != "NOT_FOUND: no such name" {
+					t.Fatalf("expected a GRPCError NOT_FOUND: no such name, got %v", record.Error)
+				}
+			}
+		}
+		context.abort()
+	}
+
+	config := &Config{url: ts.URL}
+	if err = LoadGRPC(config, descriptorSet, "test.Greeter/Chat", nil); err == nil {
+		t.Fatal("expected an error for a streaming method")
+	}
+	if err = LoadGRPC(config, descriptorSet, "test.Greeter/Missing", nil); err == nil {
+		t.Fatal("expected an error for a missing method")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// histogramPrecision is the number of bits of the sub-buckets per power of
+// two, values are kept within 0.1%
+const histogramPrecision = 10
+
+// Histogram records durations into log-linear buckets, unlike raw samples
+// it has a bounded size and histograms of several benchmarks can be merged.
+// The zero value is an empty histogram
+type Histogram struct {
+	counts map[int]int64 // by bucket
+	count  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+
+	mean float64 // running mean and sum of squared differences, for the
+	m2   float64 // standard deviation
+}
+
+func histogramBucket(d time.Duration) int {
+	v := uint64(d)
+	if v < 1<<histogramPrecision {
+		return int(v)
+	}
+	shift := bits.Len64(v) - histogramPrecision - 1
+	return shift<<histogramPrecision + int(v>>uint(shift))
+}
+
+// histogramBucketMax returns the highest duration of a bucket
+func histogramBucketMax(bucket int) time.Duration {
+	if bucket < 1<<histogramPrecision {
+		return time.Duration(bucket)
+	}
+	shift := bucket>>histogramPrecision - 1
+	m := bucket - shift<<histogramPrecision
+	return time.Duration((uint64(m)+1)<<uint(shift) - 1)
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	if h.counts == nil {
+		h.counts = make(map[int]int64)
+	}
+	h.counts[histogramBucket(d)]++
+
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+
+	delta := float64(d) - h.mean
+	h.mean += delta / float64(h.count)
+	h.m2 += delta * (float64(d) - h.mean)
+}
+
+// Merge adds the durations recorded by other
+func (h *Histogram) Merge(other *Histogram) {
+	if other.count == 0 {
+		return
+	}
+	if h.counts == nil {
+		h.counts = make(map[int]int64)
+	}
+	for bucket, count := range other.counts {
+		h.counts[bucket] += count
+	}
+
+	if h.count == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+
+	count := h.count + other.count
+	delta := other.mean - h.mean
+	h.mean += delta * float64(other.count) / float64(count)
+	h.m2 += other.m2 + delta*delta*float64(h.count)*float64(other.count)/float64(count)
+	h.count = count
+	h.sum += other.sum
+}
+
+func (h *Histogram) Count() int {
+	return int(h.count)
+}
+
+func (h *Histogram) Sum() time.Duration {
+	return h.sum
+}
+
+func (h *Histogram) Min() time.Duration {
+	return h.min
+}
+
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// StdDev returns the standard deviation in nanoseconds
+func (h *Histogram) StdDev() float64 {
+	if h.count == 0 {
+		return 0
+	}
+	return math.Sqrt(h.m2 / float64(h.count))
+}
+
+// Percentile returns the duration percentage percent of the recorded
+// durations are below, as the highest duration of its bucket
+func (h *Histogram) Percentile(percentage float64) time.Duration {
+	rank := int64(percentage * float64(h.count) / 100)
+	if rank >= h.count {
+		return h.max
+	}
+
+	var seen int64
+	for _, bucket := range h.buckets() {
+		seen += h.counts[bucket]
+		if seen > rank {
+			d := histogramBucketMax(bucket)
+			if d > h.max {
+				d = h.max
+			}
+			if d < h.min {
+				d = h.min
+			}
+			return d
+		}
+	}
+	return h.max
+}
+
+// Distribution counts the recorded durations into bins of equal width
+// from lower to upper, durations outside are counted in the first or last
+// bin
+func (h *Histogram) Distribution(lower, upper time.Duration, bins int) []int64 {
+	counts := make([]int64, bins)
+	width := float64(upper-lower) / float64(bins)
+	for bucket, count := range h.counts {
+		d := histogramBucketMax(bucket)
+		if d > h.max {
+			d = h.max
+		}
+		if d < h.min {
+			d = h.min
+		}
+
+		bin := 0
+		if width > 0 {
+			bin = int(float64(d-lower) / width)
+		}
+		if bin < 0 {
+			bin = 0
+		}
+		if bin >= bins {
+			bin = bins - 1
+		}
+		counts[bin] += count
+	}
+	return counts
+}
+
+func (h *Histogram) buckets() []int {
+	buckets := make([]int, 0, len(h.counts))
+	for bucket := range h.counts {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+	return buckets
+}
+
+type histogramJSON struct {
+	Counts map[int]int64 `json:"counts,omitempty"`
+	Count  int64         `json:"count"`
+	Sum    time.Duration `json:"sum"`
+	Min    time.Duration `json:"min"`
+	Max    time.Duration `json:"max"`
+	Mean   float64       `json:"mean"`
+	M2     float64       `json:"m2"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&histogramJSON{h.counts, h.count, h.sum, h.min, h.max, h.mean, h.m2})
+}
+
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var v histogramJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*h = Histogram{v.Counts, v.Count, v.Sum, v.Min, v.Max, v.Mean, v.M2}
+	return nil
+}
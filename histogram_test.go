@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 1023, 1024, 2047, 2048, 999999, time.Millisecond, 30 * time.Second, 1<<62 + 12345} {
+		bucket := histogramBucket(d)
+		if max := histogramBucketMax(bucket); max < d || float64(max-d) > float64(d)/1000 {
+			t.Errorf("expected the bucket of %d to end within 0.1%% above it, got %d", d, max)
+		}
+		if bucket > 0 && histogramBucketMax(bucket-1) >= d {
+			t.Errorf("expected %d above the bucket before its own, got %d", d, histogramBucketMax(bucket-1))
+		}
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	histogram := &Histogram{}
+	for i := 1; i <= 100; i++ {
+		histogram.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	if histogram.Count() != 100 || histogram.Min() != time.Millisecond || histogram.Max() != 100*time.Millisecond {
+		t.Fatalf("expected 100 durations of 1ms to 100ms, got %d of %s to %s", histogram.Count(), histogram.Min(), histogram.Max())
+	}
+	if mean := histogram.Mean(); mean != 50500*time.Microsecond {
+		t.Fatalf("expected a mean of 50.5ms, got %s", mean)
+	}
+	for percentage, expected := range map[float64]time.Duration{50: 51, 95: 96, 100: 100} {
+		if d := histogram.Percentile(percentage) / time.Millisecond; d != expected {
+			t.Errorf("expected %d%% within %dms, got %dms", int(percentage), expected, d)
+		}
+	}
+}
+
+func TestHistogramDistribution(t *testing.T) {
+	histogram := &Histogram{}
+	for i := 1; i <= 100; i++ {
+		histogram.Record(time.Duration(i) * time.Millisecond)
+	}
+	histogram.Record(time.Second)
+
+	counts := histogram.Distribution(0, 100*time.Millisecond, 4)
+	expected := []int64{24, 25, 25, 27}
+	for i := range expected {
+		if counts[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, counts)
+		}
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	all, first, second := &Histogram{}, &Histogram{}, &Histogram{}
+	for i := 0; i < 1000; i++ {
+		d := time.Duration(rand.Int63n(int64(time.Second)))
+		all.Record(d)
+		if i%3 == 0 {
+			first.Record(d)
+		} else {
+			second.Record(d)
+		}
+	}
+
+	merged := &Histogram{}
+	merged.Merge(first)
+	merged.Merge(second)
+	merged.Merge(&Histogram{})
+
+	if merged.Count() != all.Count() || merged.Sum() != all.Sum() || merged.Min() != all.Min() || merged.Max() != all.Max() {
+		t.Fatalf("expected the merged histogram to match, got %d %s %s %s, expected %d %s %s %s",
+			merged.Count(), merged.Sum(), merged.Min(), merged.Max(), all.Count(), all.Sum(), all.Min(), all.Max())
+	}
+	if math.Abs(merged.StdDev()-all.StdDev()) > 1 {
+		t.Errorf("expected a standard deviation of %f, got %f", all.StdDev(), merged.StdDev())
+	}
+	if merged.Percentile(99) != all.Percentile(99) {
+		t.Errorf("expected 99%% within %s, got %s", all.Percentile(99), merged.Percentile(99))
+	}
+}
+
+func TestHistogramJSON(t *testing.T) {
+	histogram := &Histogram{}
+	for _, d := range []time.Duration{3, 5 * time.Millisecond, time.Second} {
+		histogram.Record(d)
+	}
+
+	data, err := json.Marshal(histogram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Histogram{}
+	if err = json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Count() != 3 || decoded.Min() != 3 || decoded.Percentile(50) != histogram.Percentile(50) || decoded.StdDev() != histogram.StdDev() {
+		t.Fatalf("expected %s to decode to the histogram", data)
+	}
+}
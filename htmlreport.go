@@ -0,0 +1,597 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// charts are drawn as inline SVG so the report is a single file that needs
+// no scripts or network access to be viewed
+const (
+	chartWidth  = 720
+	chartHeight = 240
+	chartLeft   = 60 // room for the labels of the y axis
+	chartRight  = 15
+	chartTop    = 10
+	chartBottom = 30 // room for the labels of the x axis
+	chartTicks  = 4  // intervals of the y axis, at most
+
+	distributionBins = 40
+	percentileNines  = 4 // the percentile curve ends at 99.99%
+
+	pieRadius = 90
+)
+
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+// sensitiveNames match headers and query parameters which carry credentials
+var sensitiveNames = []string{"auth", "cookie", "token", "key", "secret", "pass", "sig", "session"}
+
+// chart is a line or bar chart, its values are scaled to the plot area
+type chart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	Lines  []chartLine
+	Bars   []chartBar
+	XTicks []chartTick
+	YTicks []chartTick
+
+	minX, maxX float64
+	maxY       float64
+}
+
+type chartLine struct {
+	Name   string
+	Color  string
+	Points string
+}
+
+type chartBar struct {
+	X, Y, Width, Height float64
+	Title               string
+}
+
+type chartTick struct {
+	Position float64
+	Label    string
+}
+
+type pieChart struct {
+	Title  string
+	Slices []pieSlice
+}
+
+type pieSlice struct {
+	Name    string
+	Count   int
+	Percent float64
+	Color   string
+	Path    string
+}
+
+type htmlReport struct {
+	Title     string
+	Generated string
+	Summary   []Tag
+	Charts    []*chart
+	Pies      []*pieChart
+	Config    []Tag
+	Text      string
+}
+
+// WriteHTMLReport writes the results of a benchmark to filename as a self
+// contained HTML page with charts
+func WriteHTMLReport(context *Context, stats *Stats, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err = htmlReportTemplate.Execute(f, newHTMLReport(context, stats)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func newHTMLReport(context *Context, stats *Stats) *htmlReport {
+	config := context.config
+	report := &htmlReport{
+		Title:     "Benchmark of " + redactURL(config.url),
+		Generated: time.Now().Format(time.RFC1123),
+		Text:      strings.TrimSpace(redactRequestURI(config.url, FormatReport(context, stats))),
+	}
+
+	report.Summary = []Tag{
+		{"Complete requests", strconv.Itoa(stats.totalRequests)},
+		{"Failed requests", strconv.Itoa(stats.totalFailedReqeusts)},
+		{"Time taken", fmt.Sprintf("%.2f seconds", stats.totalExecutionTime.Seconds())},
+	}
+	if stats.totalExecutionTime > 0 {
+		report.Summary = append(report.Summary, Tag{"Requests per second", fmt.Sprintf("%.2f", float64(stats.totalRequests)/stats.totalExecutionTime.Seconds())})
+	}
+	if responseTimes := &stats.responseTimes; responseTimes.Count() > 0 {
+		report.Summary = append(report.Summary,
+			Tag{"Mean response time", formatMilliseconds(responseTimes.Mean()) + " ms"},
+			Tag{"50% within", formatMilliseconds(responseTimes.Percentile(50)) + " ms"},
+			Tag{"95% within", formatMilliseconds(responseTimes.Percentile(95)) + " ms"},
+			Tag{"99% within", formatMilliseconds(responseTimes.Percentile(99)) + " ms"},
+			Tag{"Longest request", formatMilliseconds(responseTimes.Max()) + " ms"},
+		)
+	}
+
+	for _, c := range []*chart{latencyChart(stats), throughputChart(stats), distributionChart(stats), percentileChart(stats)} {
+		if c != nil {
+			report.Charts = append(report.Charts, c)
+		}
+	}
+
+	if len(stats.statusCodes) > 0 {
+		report.Pies = append(report.Pies, newPieChart("Status codes", stats.statusCodes))
+	}
+	errors := make(map[string]int)
+	for name, count := range map[string]int{
+		"Connect":           stats.errConnect,
+		"Ephemeral ports":   stats.errPorts,
+		"Receive":           stats.errReceive,
+		"Length":            stats.errLength,
+		"Exceptions":        stats.errException,
+		"Non-2xx responses": stats.errResponse,
+		"Extractions":       stats.errExtract,
+	} {
+		if count > 0 {
+			errors[name] = count
+		}
+	}
+	if len(errors) > 0 {
+		report.Pies = append(report.Pies, newPieChart("Errors", errors))
+	}
+
+	report.Config = []Tag{
+		{"URL", redactURL(config.url)},
+		{"Server Software", context.GetString(FieldServerName)},
+	}
+	if len(config.agents) > 0 {
+		report.Config = append(report.Config, Tag{"Agents", strings.Join(config.agents, ", ")})
+	}
+	for _, option := range config.options {
+		report.Config = append(report.Config, Tag{"-" + option.Key, option.Value})
+	}
+	report.Config = append(report.Config, Tag{"Version", GBVersion})
+
+	return report
+}
+
+// latencyChart draws percentiles of the response times per second
+func latencyChart(stats *Stats) *chart {
+	if stats.responseTimes.Count() == 0 || len(stats.timeline) == 0 {
+		return nil
+	}
+
+	var maxY float64
+	for _, secondStats := range stats.timeline {
+		maxY = math.Max(maxY, milliseconds(secondStats.responseTimes.Percentile(99)))
+	}
+	c := newChart("Response times over time", "seconds", "ms", 0, float64(len(stats.timeline)), maxY)
+	c.addTimeTicks()
+
+	series := []struct {
+		name  string
+		value func(*Histogram) time.Duration
+	}{
+		{"mean", (*Histogram).Mean},
+		{"50%", func(h *Histogram) time.Duration { return h.Percentile(50) }},
+		{"95%", func(h *Histogram) time.Duration { return h.Percentile(95) }},
+		{"99%", func(h *Histogram) time.Duration { return h.Percentile(99) }},
+	}
+	for _, s := range series {
+		var xs, ys []float64
+		for i, secondStats := range stats.timeline {
+			if secondStats.responseTimes.Count() > 0 {
+				xs = append(xs, float64(i)+0.5)
+				ys = append(ys, milliseconds(s.value(&secondStats.responseTimes)))
+			}
+		}
+		c.addLine(s.name, xs, ys)
+	}
+	return c
+}
+
+// throughputChart draws the requests completed per second
+func throughputChart(stats *Stats) *chart {
+	if len(stats.timeline) == 0 {
+		return nil
+	}
+
+	var xs, requests, failed []float64
+	for i, secondStats := range stats.timeline {
+		// the last second is usually cut short
+		seconds := math.Min(1, stats.totalExecutionTime.Seconds()-float64(i))
+		if seconds <= 0 {
+			seconds = 1
+		}
+		xs = append(xs, float64(i)+0.5)
+		requests = append(requests, float64(secondStats.totalRequests)/seconds)
+		failed = append(failed, float64(secondStats.totalFailedReqeusts)/seconds)
+	}
+
+	var maxY float64
+	for _, y := range requests {
+		maxY = math.Max(maxY, y)
+	}
+	c := newChart("Throughput over time", "seconds", "#/sec", 0, float64(len(stats.timeline)), maxY)
+	c.addTimeTicks()
+	c.addLine("requests", xs, requests)
+	c.addLine("failed", xs, failed)
+	return c
+}
+
+// distributionChart draws a histogram of the response times, the slowest
+// 0.1% are counted in the last bar
+func distributionChart(stats *Stats) *chart {
+	responseTimes := &stats.responseTimes
+	if responseTimes.Count() == 0 {
+		return nil
+	}
+
+	lower, upper := responseTimes.Min(), responseTimes.Percentile(99.9)
+	if upper <= lower {
+		upper = lower + time.Millisecond
+	}
+	counts := responseTimes.Distribution(lower, upper, distributionBins)
+
+	var maxY float64
+	for _, count := range counts {
+		maxY = math.Max(maxY, float64(count))
+	}
+	minX, maxX := milliseconds(lower), milliseconds(upper)
+	c := newChart("Response time distribution", "ms", "requests", minX, maxX, maxY)
+	step := niceStep((maxX - minX) / 6)
+	for x := math.Ceil(minX/step) * step; x <= maxX; x += step {
+		c.XTicks = append(c.XTicks, chartTick{c.x(x), formatChartValue(x)})
+	}
+
+	width := (maxX - minX) / distributionBins
+	for i, count := range counts {
+		from, to := minX+float64(i)*width, minX+float64(i+1)*width
+		title := fmt.Sprintf("%s - %s ms: %d", formatChartValue(from), formatChartValue(to), count)
+		if i == len(counts)-1 {
+			title = fmt.Sprintf("%s ms and above: %d", formatChartValue(from), count)
+		}
+		c.Bars = append(c.Bars, chartBar{
+			X:      c.x(from),
+			Y:      c.y(float64(count)),
+			Width:  math.Max(c.x(to)-c.x(from)-1, 1),
+			Height: c.y(0) - c.y(float64(count)),
+			Title:  title,
+		})
+	}
+	return c
+}
+
+// percentileChart draws the response time by percentile on a scale where
+// every nine takes the same width: 90%, 99%, 99.9%...
+func percentileChart(stats *Stats) *chart {
+	responseTimes := &stats.responseTimes
+	if responseTimes.Count() == 0 {
+		return nil
+	}
+
+	// nines beyond the number of requests would repeat the longest one
+	nines := int(math.Log10(float64(responseTimes.Count())))
+	if nines > percentileNines {
+		nines = percentileNines
+	}
+	if nines < 1 {
+		nines = 1
+	}
+
+	c := newChart("Response time by percentile", "percentile", "ms", 0, float64(nines), milliseconds(responseTimes.Percentile(100*(1-math.Pow(10, -float64(nines))))))
+	for nine := 0; nine <= nines; nine++ {
+		percentage := 100 * (1 - math.Pow(10, -float64(nine)))
+		c.XTicks = append(c.XTicks, chartTick{c.x(float64(nine)), formatChartValue(percentage) + "%"})
+	}
+
+	var xs, ys []float64
+	for x := 0.0; x <= float64(nines)+1e-9; x += 0.05 {
+		xs = append(xs, x)
+		ys = append(ys, milliseconds(responseTimes.Percentile(100*(1-math.Pow(10, -x)))))
+	}
+	c.addLine("response time", xs, ys)
+	return c
+}
+
+func newChart(title, xLabel, yLabel string, minX, maxX, maxY float64) *chart {
+	if maxX <= minX {
+		maxX = minX + 1
+	}
+	if maxY <= 0 {
+		maxY = 1
+	}
+	step := niceStep(maxY / chartTicks)
+	maxY = math.Ceil(maxY/step-1e-9) * step
+
+	c := &chart{Title: title, XLabel: xLabel, YLabel: yLabel, minX: minX, maxX: maxX, maxY: maxY}
+	for y := 0.0; y <= maxY+step/2; y += step {
+		c.YTicks = append(c.YTicks, chartTick{c.y(y), formatChartValue(y)})
+	}
+	return c
+}
+
+func (c *chart) x(value float64) float64 {
+	return chartLeft + (value-c.minX)/(c.maxX-c.minX)*(chartWidth-chartLeft-chartRight)
+}
+
+func (c *chart) y(value float64) float64 {
+	return chartHeight - chartBottom - value/c.maxY*(chartHeight-chartBottom-chartTop)
+}
+
+func (c *chart) addTimeTicks() {
+	step := math.Max(1, niceStep(c.maxX/6))
+	for x := 0.0; x <= c.maxX; x += step {
+		c.XTicks = append(c.XTicks, chartTick{c.x(x), formatChartValue(x)})
+	}
+}
+
+func (c *chart) addLine(name string, xs, ys []float64) {
+	points := make([]string, len(xs))
+	for i := range xs {
+		points[i] = fmt.Sprintf("%.1f,%.1f", c.x(xs[i]), c.y(math.Min(ys[i], c.maxY)))
+	}
+	c.Lines = append(c.Lines, chartLine{name, chartColors[len(c.Lines)%len(chartColors)], strings.Join(points, " ")})
+}
+
+// Width, Height, Left, Right, Top and Bottom are the geometry of charts
+// for the template, ticks end at TickEnd below the x axis
+func (c *chart) Width() int   { return chartWidth }
+func (c *chart) Height() int  { return chartHeight }
+func (c *chart) Left() int    { return chartLeft }
+func (c *chart) Right() int   { return chartWidth - chartRight }
+func (c *chart) Top() int     { return chartTop }
+func (c *chart) Bottom() int  { return chartHeight - chartBottom }
+func (c *chart) TickEnd() int { return chartHeight - chartBottom + 4 }
+
+// newPieChart draws counts by name, largest first
+func newPieChart(title string, counts map[string]int) *pieChart {
+	names := sortedKeys(counts)
+	sort.SliceStable(names, func(i, j int) bool { return counts[names[i]] > counts[names[j]] })
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	pie := &pieChart{Title: title}
+	angle := 0.0
+	for i, name := range names {
+		fraction := float64(counts[name]) / float64(total)
+		slice := pieSlice{
+			Name:    name,
+			Count:   counts[name],
+			Percent: 100 * fraction,
+			Color:   chartColors[i%len(chartColors)],
+		}
+
+		if fraction >= 1 {
+			slice.Path = fmt.Sprintf("M %d 0 A %d %d 0 1 1 %d 0 A %d %d 0 1 1 %d 0 Z", -pieRadius, pieRadius, pieRadius, pieRadius, pieRadius, pieRadius, -pieRadius)
+		} else {
+			// slices start at the top and go clockwise
+			end := angle + 2*math.Pi*fraction
+			large := 0
+			if fraction > 0.5 {
+				large = 1
+			}
+			slice.Path = fmt.Sprintf("M 0 0 L %.2f %.2f A %d %d 0 %d 1 %.2f %.2f Z",
+				pieRadius*math.Sin(angle), -pieRadius*math.Cos(angle),
+				pieRadius, pieRadius, large,
+				pieRadius*math.Sin(end), -pieRadius*math.Cos(end))
+			angle = end
+		}
+		pie.Slices = append(pie.Slices, slice)
+	}
+	return pie
+}
+
+// Radius and Size are the geometry of pie charts for the template
+func (p *pieChart) Radius() int { return pieRadius }
+func (p *pieChart) Size() int   { return 2 * pieRadius }
+
+// niceStep rounds a step of axis ticks to 1, 2 or 5 times a power of ten
+func niceStep(value float64) float64 {
+	if value <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(value)))
+	for _, factor := range []float64{1, 2, 5} {
+		if value <= factor*magnitude {
+			return factor * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatChartValue(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// maskOption hides the credentials in the value of an option and request
+// bodies, which may carry them, the report is meant to be shared
+func maskOption(name, value string) string {
+	switch name {
+	case "d", "data":
+		// files are named without their directory
+		if path := strings.TrimPrefix(value, "@"); name == "data" || path != value {
+			return strings.TrimSuffix(value, path) + filepath.Base(path)
+		}
+		return "xxxxx"
+	case "F", "form":
+		if pos := strings.Index(value, "="); pos >= 0 && !strings.HasPrefix(value[pos+1:], "@") {
+			return value[:pos] + "=xxxxx"
+		}
+		return value
+	case "A":
+		if pos := strings.Index(value, ":"); pos >= 0 {
+			return value[:pos] + ":xxxxx"
+		}
+		return "xxxxx"
+	case "C":
+		if pos := strings.Index(value, "="); pos >= 0 {
+			return value[:pos] + "=xxxxx"
+		}
+		return "xxxxx"
+	case "H":
+		pos := strings.Index(value, ":")
+		if pos < 0 {
+			return value
+		}
+		if sensitiveName(value[:pos]) {
+			return value[:pos] + ": xxxxx"
+		}
+		return value
+	case "X", "push":
+		return redactURL(value)
+	case "agent-token":
+		return "xxxxx"
+	}
+	return value
+}
+
+// redactRequestURI masks the path and query of rawurl in text like redactURL
+func redactRequestURI(rawurl, text string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return text
+	}
+	redacted, err := url.Parse(redactURL(rawurl))
+	if err != nil {
+		return text
+	}
+	return strings.Replace(text, u.RequestURI(), redacted.RequestURI(), -1)
+}
+
+// redactURL hides the user info of a url, of sinks it is a token alone, and
+// the values of query parameters named like credentials
+func redactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+
+	masked := false
+	if u.User != nil {
+		u.User = url.User("xxxxx")
+		masked = true
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name, values := range query {
+			if sensitiveName(name) {
+				for i := range values {
+					values[i] = "xxxxx"
+				}
+				masked = true
+			}
+		}
+		if masked {
+			u.RawQuery = query.Encode()
+		}
+	}
+
+	if !masked {
+		return rawurl
+	}
+	return u.String()
+}
+
+func sensitiveName(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; margin: 2em auto; max-width: 760px; padding: 0 1em; }
+h1 { font-size: 1.5em; word-break: break-all; }
+h2 { font-size: 1.15em; margin-top: 2em; border-bottom: 1px solid #ddd; padding-bottom: .2em; }
+table { border-collapse: collapse; }
+td { padding: .2em 1em .2em 0; vertical-align: top; }
+td:first-child { color: #555; white-space: nowrap; }
+td code { word-break: break-all; }
+.generated { color: #777; font-size: .9em; }
+.legend span { display: inline-block; margin-right: 1.2em; font-size: .9em; }
+.legend i { display: inline-block; width: .8em; height: .8em; margin-right: .3em; }
+.pies { display: flex; flex-wrap: wrap; gap: 2em; }
+svg text { font-size: 11px; fill: #555; }
+svg .axis { stroke: #999; }
+svg .grid { stroke: #eee; }
+svg .bar { fill: #1f77b4; }
+pre { background: #f6f6f6; padding: 1em; overflow-x: auto; font-size: .85em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="generated">Generated by GoHttpBench on {{.Generated}}</p>
+
+<h2>Summary</h2>
+<table>
+{{range .Summary}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" role="img" aria-label="{{.Title}}">
+{{$c := .}}{{range .YTicks}}<line class="grid" x1="{{$c.Left}}" x2="{{$c.Right}}" y1="{{printf "%.1f" .Position}}" y2="{{printf "%.1f" .Position}}"/>
+<text x="{{$c.Left}}" y="{{printf "%.1f" .Position}}" dx="-6" dy="4" text-anchor="end">{{.Label}}</text>
+{{end}}{{range .XTicks}}<line class="axis" x1="{{printf "%.1f" .Position}}" x2="{{printf "%.1f" .Position}}" y1="{{$c.Bottom}}" y2="{{$c.TickEnd}}"/>
+<text x="{{printf "%.1f" .Position}}" y="{{$c.Bottom}}" dy="16" text-anchor="middle">{{.Label}}</text>
+{{end}}{{range .Bars}}<rect class="bar" x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" width="{{printf "%.1f" .Width}}" height="{{printf "%.1f" .Height}}"><title>{{.Title}}</title></rect>
+{{end}}{{range .Lines}}<polyline fill="none" stroke="{{.Color}}" stroke-width="1.5" points="{{.Points}}"><title>{{.Name}}</title></polyline>
+{{end}}<line class="axis" x1="{{.Left}}" x2="{{.Right}}" y1="{{.Bottom}}" y2="{{.Bottom}}"/>
+<line class="axis" x1="{{.Left}}" x2="{{.Left}}" y1="{{.Top}}" y2="{{.Bottom}}"/>
+<text x="{{.Right}}" y="{{.Height}}" dy="-2" text-anchor="end">{{.XLabel}}</text>
+<text x="4" y="{{.Top}}" dy="4">{{.YLabel}}</text>
+</svg>
+{{if gt (len .Lines) 1}}<div class="legend">{{range .Lines}}<span><i style="background: {{.Color}}"></i>{{.Name}}</span>{{end}}</div>
+{{end}}{{end}}
+{{if .Pies}}<div class="pies">
+{{range .Pies}}<div>
+<h2>{{.Title}}</h2>
+<svg width="{{.Size}}" height="{{.Size}}" viewBox="-{{.Radius}} -{{.Radius}} {{.Size}} {{.Size}}" role="img" aria-label="{{.Title}}">
+{{range .Slices}}<path d="{{.Path}}" fill="{{.Color}}" stroke="#fff"><title>{{.Name}}: {{.Count}}</title></path>
+{{end}}</svg>
+<div class="legend">{{range .Slices}}<span><i style="background: {{.Color}}"></i>{{.Name}}: {{.Count}} ({{printf "%.1f" .Percent}}%)</span><br>
+{{end}}</div>
+</div>
+{{end}}</div>
+{{end}}
+<h2>Configuration</h2>
+<table>
+{{range .Config}}<tr><td>{{.Key}}</td><td><code>{{.Value}}</code></td></tr>
+{{end}}</table>
+
+<h2>Report</h2>
+<pre>{{.Text}}</pre>
+</body>
+</html>
+`))
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -26,12 +33,18 @@ var (
 type HTTPWorker struct {
 	c         *Context
 	client    *http.Client
-	jobs      chan *http.Request
+	id        int
+	jobs      chan *Job
 	collector chan *Record
 	discard   io.ReaderFrom
+	vars      map[string]string // variables extracted by the steps of a scenario
+	traffic   *Traffic
+	ws        *WebSocketConn   // of the worker in websocket mode
+	upgraded  time.Duration    // handshake of ws, reported with its first message
+	stream    *webSocketStream // replies of ws when messages are sent at a rate
 }
 
-func NewHTTPWorker(context *Context, jobs chan *http.Request, collector chan *Record) *HTTPWorker {
+func NewHTTPWorker(context *Context, id int, jobs chan *Job, collector chan *Record) *HTTPWorker {
 
 	var buf []byte
 	contentSize := context.GetInt(FieldContentSize)
@@ -41,100 +54,581 @@ func NewHTTPWorker(context *Context, jobs chan *http.Request, collector chan *Re
 		buf = make([]byte, MaxBufferSize)
 	}
 
+	traffic := &Traffic{tcpInfo: context.tcpInfo}
+	client := NewClient(context.config, traffic)
+	if context.config.scenario != nil {
+		// each http worker is a virtual user with its own cookies
+		client.Jar, _ = cookiejar.New(nil)
+	}
+
 	return &HTTPWorker{
 		context,
-		NewClient(context.config),
+		client,
+		id,
 		jobs,
 		collector,
 		&Discard{buf},
+		make(map[string]string),
+		traffic,
+		nil,
+		0,
+		nil,
 	}
 }
 
 func (h *HTTPWorker) Run() {
+	// websockets of all http workers are opened before they start sending,
+	// failed ones are retried by the first job
+	if h.c.config.websocket {
+		if err := h.upgrade(); err != nil {
+			h.c.TraceException(err)
+		}
+		defer func() {
+			// replies still on their way are waited for
+			if h.stream != nil {
+				h.stream.finish()
+			}
+			if h.ws != nil {
+				h.ws.Shutdown()
+			}
+		}()
+	}
+
 	h.c.start.Done()
 	h.c.start.Wait()
 
-	timer := time.NewTimer(h.c.config.executionTimeout)
+	atomic.AddInt64(&h.c.workers, 1)
+	defer atomic.AddInt64(&h.c.workers, -1)
+
+	// kept alive connections are closed for their TCP_INFO to be collected
+	defer h.client.CloseIdleConnections()
 
 	for job := range h.jobs {
+		// stop taking queued jobs on graceful shutdown
+		if h.c.jobs.Err() != nil {
+			return
+		}
+
+		iteration := time.Now()
+		atomic.AddInt64(&h.c.inflight, 1)
+
+		var record *Record
+		if h.c.config.websocket && h.c.config.wsRate > 0 {
+			record = h.postMessage()
+		} else if h.c.config.websocket {
+			record = h.sendMessage()
+		} else if h.c.config.scenario != nil {
+			record = h.runScenario(job)
+		} else if request, err := h.request(job); err != nil {
+			record = &Record{Error: &ExceptionError{err}}
+			h.c.TraceException(err)
+		} else {
+			record = h.send(request, nil)
+		}
 
-		timer.Reset(h.c.config.executionTimeout)
-		asyncResult := h.send(job)
+		// messages sent at a rate are recorded when their replies arrive
+		if record != nil {
+			h.collect(record)
+		}
+		atomic.AddInt64(&h.c.inflight, -1)
+
+		if !h.pause(iteration) {
+			return
+		}
+	}
+}
+
+// pause waits for the think time or the rest of the pacing interval before
+// the next job, it returns false when stopped in the meantime
+func (h *HTTPWorker) pause(iteration time.Time) bool {
+	switch {
+	case h.c.config.wsRate > 0:
+		return h.sleep(time.Duration(float64(time.Second)/h.c.config.wsRate) - time.Since(iteration))
+	case h.c.config.pacing > 0:
+		return h.sleep(h.c.config.pacing - time.Since(iteration))
+	case h.c.config.thinkTime != nil:
+		return h.sleep(h.c.config.thinkTime.Next())
+	}
+	return true
+}
 
+// collect hands the record to the monitor, it is dropped if the request was
+// aborted by a hard shutdown or the time limit
+func (h *HTTPWorker) collect(record *Record) {
+	if h.c.work.Err() == nil {
 		select {
-		case record := <-asyncResult:
-			h.collector <- record
+		case h.collector <- record:
+		case <-h.c.work.Done():
+		}
+	}
+}
+
+func (h *HTTPWorker) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return h.c.jobs.Err() == nil
+	}
 
-		case <-timer.C:
-			h.collector <- &Record{Error: &ResponseTimeoutError{errors.New("execution timeout")}}
-			h.client.Transport.(*http.Transport).CancelRequest(job)
+	t := time.NewTimer(d)
+	defer t.Stop()
 
-		case <-h.c.stop:
-			h.client.Transport.(*http.Transport).CancelRequest(job)
-			timer.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-h.c.jobs.Done():
+		return false
+	}
+}
+
+func (h *HTTPWorker) request(job *Job) (*http.Request, error) {
+	if job.request != nil {
+		return job.request, nil
+	}
+	return h.c.config.template.Render(h.c.work, &TemplateVars{job.seq, h.id, job.data, nil})
+}
+
+// upgrade opens the websocket of the http worker
+func (h *HTTPWorker) upgrade() error {
+	ctx, cancel := context.WithTimeout(h.c.work, h.c.config.executionTimeout)
+	defer cancel()
+
+	request, err := NewHTTPRequest(ctx, h.c.config)
+	if err != nil {
+		return &ExceptionError{err}
+	}
+
+	sw := &StopWatch{}
+	sw.Start()
+	ws, _, err := DialWebSocket(h.client, request)
+	sw.Stop()
+	if err != nil {
+		return err
+	}
+
+	h.ws, h.upgraded = ws, sw.Elapsed
+	return nil
+}
+
+// sendMessage sends the message on the websocket of the http worker and
+// times the round trip of the reply, the websocket is reopened after errors
+func (h *HTTPWorker) sendMessage() (record *Record) {
+	record = &Record{}
+
+	received, sent := h.traffic.Received(), h.traffic.Sent()
+	defer func() {
+		record.wireReceived = h.traffic.Received() - received
+		record.wireSent = h.traffic.Sent() - sent
+		if record.Error != nil {
+			h.c.TraceException(record.Error)
+		}
+	}()
+
+	if h.ws == nil {
+		if err := h.upgrade(); err != nil {
+			record.Error = err
 			return
 		}
 	}
-	timer.Stop()
+	record.upgrade, h.upgraded = h.upgraded, 0
+
+	// a reply that doesn't arrive in time aborts the websocket
+	ctx, cancel := context.WithTimeout(h.c.work, h.c.config.executionTimeout)
+	defer cancel()
+	ws := h.ws
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stop()
+
+	sw := &StopWatch{}
+	sw.Start()
+	err := ws.WriteMessage(WebSocketText, h.c.config.wsMessage)
+	var reply []byte
+	if err == nil {
+		_, reply, err = ws.ReadMessage()
+	}
+	sw.Stop()
+
+	if err != nil {
+		ws.Close()
+		h.ws = nil
+		switch {
+		case ctx.Err() == context.DeadlineExceeded && h.c.work.Err() == nil:
+			record.Error = &ResponseTimeoutError{errors.New("execution timeout")}
+		default:
+			record.Error = &ReceiveError{err}
+		}
+		return
+	}
+
+	record.responseTime = sw.Elapsed
+	record.contentSize = int64(len(reply))
+	record.bodySent = int64(len(h.c.config.wsMessage))
+	return
 }
 
-func (h *HTTPWorker) send(request *http.Request) (asyncResult chan *Record) {
+// postMessage sends the message on the websocket of the http worker without
+// waiting for the reply, the record is sent by the stream when it arrives.
+// A broken websocket is reopened once its pending replies are recorded
+func (h *HTTPWorker) postMessage() *Record {
+	if h.stream != nil && h.stream.broken() {
+		h.stream.finish()
+		h.stream, h.ws = nil, nil
+	}
 
-	asyncResult = make(chan *Record, 1)
-	go func() {
-		record := &Record{}
-		sw := &StopWatch{}
-		sw.Start()
+	if h.ws == nil {
+		if err := h.upgrade(); err != nil {
+			h.c.TraceException(err)
+			return &Record{Error: err}
+		}
+	}
+	if h.stream == nil {
+		h.stream = newWebSocketStream(h, h.ws)
+	}
 
-		var contentSize int64
+	sent := h.traffic.Sent()
+	message := &pendingMessage{start: time.Now(), upgrade: h.upgraded}
+	h.upgraded = 0
 
-		defer func() {
-			if r := recover(); r != nil {
-				if Err, ok := r.(error); ok {
-					record.Error = Err
+	// the reply is read once the message is pending, a write error fails it
+	if err := h.ws.WriteMessage(WebSocketText, h.c.config.wsMessage); err != nil {
+		h.ws.Close()
+	}
+	message.wireSent = h.traffic.Sent() - sent
+
+	// a reply that doesn't arrive in time aborts the websocket
+	ws, stream := h.ws, h.stream
+	message.timer = time.AfterFunc(h.c.config.executionTimeout, func() {
+		atomic.StoreInt32(&stream.timedOut, 1)
+		ws.Close()
+	})
+
+	atomic.AddInt64(&h.c.inflight, 1)
+	stream.pending <- message
+	return nil
+}
+
+// pendingMessage is a message sent at a rate whose reply is awaited
+type pendingMessage struct {
+	start    time.Time
+	upgrade  time.Duration
+	wireSent int64
+	timer    *time.Timer
+}
+
+// webSocketStream reads the replies of messages sent at a rate on a
+// websocket, replies are matched to the messages in the order they were sent
+type webSocketStream struct {
+	h        *HTTPWorker
+	ws       *WebSocketConn
+	pending  chan *pendingMessage
+	done     chan struct{}
+	failed   int32 // set by the reader once the websocket broke
+	timedOut int32 // set when a reply didn't arrive in time
+}
+
+func newWebSocketStream(h *HTTPWorker, ws *WebSocketConn) *webSocketStream {
+	s := &webSocketStream{
+		h:       h,
+		ws:      ws,
+		pending: make(chan *pendingMessage, webSocketMaxPending),
+		done:    make(chan struct{}),
+	}
+	go s.read()
+	return s
+}
+
+func (s *webSocketStream) read() {
+	defer close(s.done)
+
+	// a hard shutdown or the time limit aborts replies in flight
+	stop := context.AfterFunc(s.h.c.work, func() { s.ws.Close() })
+	defer stop()
+
+	var err error
+	for message := range s.pending {
+		record := &Record{upgrade: message.upgrade, wireSent: message.wireSent}
+
+		// once broken, the messages still pending fail with the same error
+		if err == nil {
+			received := s.h.traffic.Received()
+			var reply []byte
+			_, reply, err = s.ws.ReadMessage()
+			record.wireReceived = s.h.traffic.Received() - received
+			record.responseTime = time.Since(message.start)
+			record.contentSize = int64(len(reply))
+			record.bodySent = int64(len(s.h.c.config.wsMessage))
+
+			if err != nil {
+				s.ws.Close()
+				atomic.StoreInt32(&s.failed, 1)
+				if atomic.LoadInt32(&s.timedOut) == 1 && s.h.c.work.Err() == nil {
+					err = &ResponseTimeoutError{errors.New("execution timeout")}
 				} else {
-					record.Error = &ExceptionError{errors.New(fmt.Sprint(r))}
+					err = &ReceiveError{err}
 				}
+				s.h.c.TraceException(err)
+			}
+		}
+		message.timer.Stop()
 
-			} else {
-				record.contentSize = contentSize
-				record.responseTime = sw.Elapsed
+		if err != nil {
+			record = &Record{Error: err, upgrade: message.upgrade, wireSent: message.wireSent}
+		}
+		s.h.collect(record)
+		atomic.AddInt64(&s.h.c.inflight, -1)
+	}
+}
+
+func (s *webSocketStream) broken() bool {
+	return atomic.LoadInt32(&s.failed) == 1
+}
+
+// finish waits for the replies of the messages sent so far
+func (s *webSocketStream) finish() {
+	close(s.pending)
+	<-s.done
+}
+
+// runScenario sends the steps of the scenario in order and returns the
+// record of the whole transaction, the flow ends at the first failed step
+func (h *HTTPWorker) runScenario(job *Job) (record *Record) {
+	record = &Record{}
+
+	// the transaction is timed from the first step to the end of the last,
+	// think time between steps included
+	sw := &StopWatch{}
+	sw.Start()
+	defer func() {
+		sw.Stop()
+		record.responseTime = sw.Elapsed
+	}()
+
+	// variables are scoped to a single pass through the scenario
+	for name := range h.vars {
+		delete(h.vars, name)
+	}
+	vars := &TemplateVars{job.seq, h.id, job.data, h.vars}
+
+	for i, step := range h.c.config.scenario.Steps {
+		// the virtual user thinks between steps too, the rest of the flow is
+		// sent right away on graceful shutdown
+		if i > 0 && h.c.config.thinkTime != nil {
+			h.sleep(h.c.config.thinkTime.Next())
+		}
+
+		var stepRecord *Record
+		if request, err := step.template.Render(h.c.work, vars); err != nil {
+			stepRecord = &Record{Error: &ExceptionError{err}}
+			h.c.TraceException(err)
+		} else {
+			stepRecord = h.send(request, func(resp *http.Response, body []byte) error {
+				return step.extract(resp, body, h.vars)
+			})
+		}
+
+		record.steps = append(record.steps, stepRecord)
+		record.contentSize += stepRecord.contentSize
+		record.bodySent += stepRecord.bodySent
+		record.decodedSize += stepRecord.decodedSize
+		record.decodeTime += stepRecord.decodeTime
+		record.wireReceived += stepRecord.wireReceived
+		record.wireSent += stepRecord.wireSent
+		record.status = stepRecord.status
+
+		if stepRecord.Error != nil {
+			record.Error = stepRecord.Error
+			return
+		}
+	}
+	return
+}
+
+// send sends the request and discards the response body, the body is read
+// into memory and handed to extract instead when it is given
+func (h *HTTPWorker) send(request *http.Request, extract func(*http.Response, []byte) error) (record *Record) {
+
+	record = &Record{}
+	sw := &StopWatch{}
+	sw.Start()
+
+	// streamed responses are held open for the duration instead, it starts
+	// after the stopwatch so held streams last at least as long
+	timeout := h.c.config.executionTimeout
+	if h.c.config.sse > 0 {
+		timeout = h.c.config.sse
+	}
+	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+	defer cancel()
+
+	var contentSize int64
+
+	// the worker sends one request at a time, traffic on its connections in
+	// the meantime belongs to this request
+	received, sent := h.traffic.Received(), h.traffic.Sent()
+
+	// the address requests are sent to is reported per ip, TLS handshakes
+	// of new connections are reported apart
+	var remoteAddr string
+	var tlsStart time.Time
+	var tlsHandshake time.Duration
+	var tlsResumed bool
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil {
+				tlsHandshake = time.Since(tlsStart)
+				tlsResumed = state.DidResume
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			remoteAddr = info.Conn.RemoteAddr().String()
+			if !info.Reused {
+				record.tlsHandshake = tlsHandshake
+				record.tlsResumed = tlsResumed
 			}
+		},
+	})
+
+	// new connections through a proxy are traced for the proxy connect time
+	var proxy *ProxyTrace
+	if h.c.config.proxy != nil {
+		if proxyURL, _ := h.c.config.proxy(request); proxyURL != nil {
+			proxy = &ProxyTrace{}
+			ctx = httptrace.WithClientTrace(ctx, proxy.ClientTrace())
+		}
+	}
+
+	request = request.WithContext(ctx)
+	var body *CountingBody
+	if request.Body != nil && request.Body != http.NoBody {
+		body = &CountingBody{body: request.Body}
+		request.Body = body
+	}
 
-			if record.Error != nil {
-				TraceException(record.Error)
+	defer func() {
+		record.wireReceived = h.traffic.Received() - received
+		record.wireSent = h.traffic.Sent() - sent
+		if body != nil {
+			record.bodySent = body.Count()
+		}
+		if proxy != nil {
+			record.proxyConnect = proxy.Elapsed
+		}
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			record.remoteIP = host
+		}
+
+		if r := recover(); r != nil {
+			if Err, ok := r.(error); ok {
+				record.Error = Err
+			} else {
+				record.Error = &ExceptionError{errors.New(fmt.Sprint(r))}
 			}
 
-			asyncResult <- record
-		}()
+		} else {
+			record.contentSize = contentSize
+			record.responseTime = sw.Elapsed
+		}
 
-		resp, err := h.client.Do(request)
-		if err != nil {
+		if record.Error != nil {
+			if ctx.Err() == context.DeadlineExceeded && h.c.work.Err() == nil {
+				record.Error = &ResponseTimeoutError{errors.New("execution timeout")}
+			}
+			h.c.TraceException(record.Error)
+		}
+	}()
+
+	resp, err := h.client.Do(request)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRNOTAVAIL) || errors.Is(err, syscall.EADDRINUSE) {
+			record.Error = &PortExhaustedError{err}
+		} else {
 			record.Error = &ConnectError{err}
-			return
 		}
+		return
+	}
 
-		defer resp.Body.Close()
+	defer resp.Body.Close()
+	record.protocol = resp.Proto
+	record.status = resp.StatusCode
+
+	if resp.StatusCode < 200 || resp.StatusCode > 300 {
+		record.Error = &ResponseError{err}
+		return
+	}
 
-		if resp.StatusCode < 200 || resp.StatusCode > 300 {
-			record.Error = &ResponseError{err}
+	// the transport doesn't decompress, bytes on the wire and decoded bytes
+	// are counted apart
+	wire := &TimedReader{r: resp.Body}
+	var reader io.Reader = wire
+	encoding := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	decode, decodable := contentDecoders[encoding]
+	if decodable && (request.Method == "HEAD" || resp.StatusCode == http.StatusNoContent) {
+		// the encoding is of the body a GET would have had
+		decodable, encoding = false, ""
+	}
+	// the decoders read the header of the body, the time on the wire is
+	// subtracted from the decoding time from here on
+	decodeStart := time.Now()
+	if decodable {
+		// neither are empty bodies, the decoders fail on them
+		buffered := bufio.NewReader(wire)
+		if _, err = buffered.Peek(1); err == io.EOF {
+			decodable, encoding = false, ""
+		} else if reader, err = decode(buffered); err != nil {
+			record.Error = &ReceiveError{err}
 			return
 		}
+	}
 
-		contentSize, err = h.discard.ReadFrom(resp.Body)
-		if err != nil {
-			if err == io.ErrUnexpectedEOF {
-				record.Error = &LengthError{ErrInvalidContnetSize}
-				return
-			}
+	var content bytes.Buffer
+	if h.c.config.sse > 0 {
+		events := NewEventReader(reader, h.c.config.sseFraming, sw.start)
+		record.decodedSize, err = events.ReadFrom()
+		if err != nil && ctx.Err() == context.DeadlineExceeded && h.c.work.Err() == nil {
+			err = nil // held for the duration
+		}
+		record.events, record.firstEvent, record.eventGaps = events.events, events.firstEvent, events.eventGaps
+		if err == nil && events.events == 0 {
+			err = ErrNoEvents
+		}
+	} else if extract != nil {
+		record.decodedSize, err = content.ReadFrom(reader)
+	} else {
+		record.decodedSize, err = h.discard.ReadFrom(reader)
+	}
+	contentSize = wire.n
+	record.encoding = encoding
+	if decodable {
+		record.decodeTime = time.Since(decodeStart) - wire.elapsed
+	}
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			record.Error = &LengthError{ErrInvalidContnetSize}
+			return
+		}
 
-			record.Error = &ReceiveError{err}
+		record.Error = &ReceiveError{err}
+		return
+	}
+
+	sw.Stop()
+
+	if h.c.config.grpcMethod != "" {
+		code, message := grpcStatus(resp)
+		record.grpcStatus = grpcStatusName(code)
+		if code != 0 {
+			record.Error = &GRPCError{code, errors.New(message)}
 			return
 		}
+	}
 
-		sw.Stop()
-	}()
-	return asyncResult
+	if extract != nil {
+		if err = extract(resp, content.Bytes()); err != nil {
+			record.Error = &ExtractError{err}
+		}
+	}
+	return
 }
 
 type Discard struct {
@@ -158,16 +652,38 @@ func (d *Discard) ReadFrom(r io.Reader) (n int64, err error) {
 func DetectHost(context *Context) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			TraceException(r)
+			context.TraceException(r)
 		}
 	}()
 
-	client := NewClient(context.config)
-	reqeust, err := NewHTTPRequest(context.config)
+	var reqeust *http.Request
+	config := context.config
+	client := NewClient(config, nil)
+	if config.template != nil {
+		vars := &TemplateVars{}
+		if config.feeder != nil {
+			vars.Data = config.feeder.rows[0]
+		}
+		reqeust, err = config.template.Render(context.work, vars)
+	} else {
+		reqeust, err = NewHTTPRequest(context.work, config)
+	}
 	if err != nil {
 		return
 	}
 
+	// the handshake is tried once, the size of the replies isn't known
+	if config.websocket {
+		ws, resp, err := DialWebSocket(client, reqeust)
+		if err != nil {
+			return err
+		}
+		ws.Shutdown()
+		context.SetString(FieldServerName, resp.Header.Get("Server"))
+		context.SetInt(FieldContentSize, len(config.wsMessage))
+		return nil
+	}
+
 	resp, err := client.Do(reqeust)
 
 	if err != nil {
@@ -190,68 +706,191 @@ func DetectHost(context *Context) (err error) {
 	return
 }
 
-func NewClient(config *Config) *http.Client {
+// NewClient returns a client of its own transport, bytes on the wire are
+// counted into traffic when it is given
+func NewClient(config *Config, traffic *Traffic) *http.Client {
 
 	// skip certification check for self-signed certificates
 	tlsconfig := &tls.Config{
 		InsecureSkipVerify: true,
 	}
+	if config.tlsResume {
+		tlsconfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
 
-	// TODO: tcp options
-	// TODO: monitor tcp metrics
+	// tcp options are applied and tcp metrics collected by the dialer,
+	// responses are decompressed by the http worker to count bytes on the wire
 	transport := &http.Transport{
-		DisableCompression: !config.gzip,
+		Proxy:              config.proxy,
+		DialContext:        NewDialer(config, traffic),
+		DisableCompression: true,
 		DisableKeepAlives:  !config.keepAlive,
 		TLSClientConfig:    tlsconfig,
 	}
 
+	// HTTP/2 is negotiated with ALPN over TLS and spoken with prior
+	// knowledge over plain http, a custom TLS config disables it otherwise
+	if config.protocol == ProtocolHTTP2 {
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	}
+
 	return &http.Client{Transport: transport}
 }
 
-func NewHTTPRequest(config *Config) (request *http.Request, err error) {
+func NewHTTPRequest(ctx context.Context, config *Config) (request *http.Request, err error) {
 
 	var body io.Reader
 
-	if config.method == "POST" || config.method == "PUT" {
+	switch {
+	case config.bodyFile != "":
+		body = NewFileBody(config.bodyFile)
+	case config.bodyContent != nil && config.bodyEncoding != "":
+		var content []byte
+		if content, err = EncodeBody(config.bodyEncoding, config.bodyContent); err != nil {
+			return
+		}
+		body = bytes.NewReader(content)
+	case config.bodyContent != nil:
 		body = bytes.NewReader(config.bodyContent)
 	}
 
-	request, err = http.NewRequest(config.method, config.url, body)
+	request, err = http.NewRequestWithContext(ctx, config.method, config.url, body)
 
 	if err != nil {
 		return
 	}
 
-	request.Header.Set("Content-Type", config.contentType)
+	if config.bodyFile != "" {
+		request.ContentLength = config.bodySize
+		request.GetBody = func() (io.ReadCloser, error) {
+			return NewFileBody(config.bodyFile), nil
+		}
+	}
+
+	if config.chunked && body != nil {
+		// an unknown length makes the transport send the body chunked
+		request.ContentLength = -1
+	}
+
+	switch {
+	case config.form != nil:
+		request.Header.Set("Content-Type", config.form.ContentType())
+	case body != nil:
+		request.Header.Set("Content-Type", config.contentType)
+	}
 	request.Header.Set("User-Agent", config.userAgent)
 
+	if config.gzip {
+		request.Header.Set("Accept-Encoding", AcceptEncoding)
+	}
+
+	if body != nil && config.bodyEncoding != "" {
+		request.Header.Set("Content-Encoding", config.bodyEncoding)
+	}
+
 	if config.keepAlive {
 		request.Header.Set("Connection", "keep-alive")
 	}
 
+	// the first occurrence of a header overrides the default, the following
+	// ones are added and an empty value removes the header
+	overridden := make(map[string]bool)
 	for _, header := range config.headers {
-		pair := strings.Split(header, ":")
-		request.Header.Add(pair[0], pair[1])
+		var name, value string
+		if name, value, err = ParseHeader(header); err != nil {
+			return
+		}
+
+		switch {
+		case name == "Host":
+			request.Host = value
+		case value == "":
+			request.Header.Del(name)
+			if name == "User-Agent" {
+				// an empty user agent keeps the client from sending its own
+				request.Header.Set(name, "")
+			}
+		case overridden[name]:
+			request.Header.Add(name, value)
+		default:
+			request.Header.Set(name, value)
+		}
+		overridden[name] = true
 	}
 
 	for _, cookie := range config.cookies {
-		pair := strings.Split(cookie, "=")
-		c := &http.Cookie{Name: pair[0], Value: pair[1]}
-		request.AddCookie(c)
+		var name, value string
+		if name, value, err = ParseCookie(cookie); err != nil {
+			return
+		}
+		request.AddCookie(&http.Cookie{Name: name, Value: value})
 	}
 
 	if config.basicAuthentication != "" {
-		pair := strings.Split(config.basicAuthentication, ":")
-		request.SetBasicAuth(pair[0], pair[1])
+		var username, password string
+		if username, password, err = ParseBasicAuthentication(config.basicAuthentication); err != nil {
+			return
+		}
+		request.SetBasicAuth(username, password)
 	}
 
 	return
 }
 
-func CopyHTTPRequest(config *Config, request *http.Request) *http.Request {
+// ParseHeader splits 'Name: value' on the first colon, the name is
+// canonicalized and the value may be empty
+func ParseHeader(header string) (name string, value string, err error) {
+	pos := strings.Index(header, ":")
+	if pos < 0 {
+		err = fmt.Errorf("invalid header %q, expected 'Name: value'", header)
+		return
+	}
+
+	name = strings.TrimSpace(header[:pos])
+	if name == "" || strings.ContainsAny(name, " \t") {
+		err = fmt.Errorf("invalid header name in %q", header)
+		return
+	}
+
+	return http.CanonicalHeaderKey(name), strings.TrimSpace(header[pos+1:]), nil
+}
+
+// ParseCookie splits 'name=value' on the first equals sign
+func ParseCookie(cookie string) (name string, value string, err error) {
+	pos := strings.Index(cookie, "=")
+	if pos < 0 {
+		err = fmt.Errorf("invalid cookie %q, expected 'name=value'", cookie)
+		return
+	}
+
+	name = strings.TrimSpace(cookie[:pos])
+	if name == "" {
+		err = fmt.Errorf("invalid cookie name in %q", cookie)
+		return
+	}
+
+	return name, strings.TrimSpace(cookie[pos+1:]), nil
+}
+
+// ParseBasicAuthentication splits 'username:password' on the first colon,
+// the password may contain colons
+func ParseBasicAuthentication(auth string) (username string, password string, err error) {
+	pos := strings.Index(auth, ":")
+	if pos < 0 {
+		// the value is left out, it holds the password
+		err = errors.New("invalid basic authentication, expected 'username:password'")
+		return
+	}
+	return auth[:pos], auth[pos+1:], nil
+}
+
+func CopyHTTPRequest(request *http.Request) *http.Request {
 	newRequest := *request
-	if request.Body != nil {
-		newRequest.Body = ioutil.NopCloser(bytes.NewReader(config.bodyContent))
+	if request.GetBody != nil {
+		// a fresh reader of the (encoded) body or file of the base request
+		newRequest.Body, _ = request.GetBody()
 	}
 	return &newRequest
 }
@@ -272,6 +911,16 @@ func (e *ConnectError) Error() string {
 	return e.err.Error()
 }
 
+// PortExhaustedError is a connect error of running out of ephemeral ports,
+// usually of many short lived connections without keepalive
+type PortExhaustedError struct {
+	err error
+}
+
+func (e *PortExhaustedError) Error() string {
+	return e.err.Error()
+}
+
 type ReceiveError struct {
 	err error
 }
@@ -296,6 +945,14 @@ func (e *ResponseError) Error() string {
 	return e.err.Error()
 }
 
+type ExtractError struct {
+	err error
+}
+
+func (e *ExtractError) Error() string {
+	return e.err.Error()
+}
+
 type ResponseTimeoutError struct {
 	err error
 }
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -46,22 +48,22 @@ func TestHTTPWithGet(t *testing.T) {
 
 	context := NewContext(config)
 	context.SetInt(FieldContentSize, len(responseStr))
-	jobs := make(chan *http.Request)
+	jobs := make(chan *Job)
 	collector := make(chan *Record)
 
-	worker := NewHTTPWorker(context, jobs, collector)
+	worker := NewHTTPWorker(context, 1, jobs, collector)
 
 	go worker.Run()
 
-	request, err := NewHTTPRequest(config)
+	request, err := NewHTTPRequest(context.work, config)
 	if err != nil {
 		t.Fatalf("new http request failed: %s", err)
 	}
 
-	jobs <- request
+	jobs <- &Job{request: request}
 	record := <-collector
 	close(jobs)
-	close(context.stop)
+	context.abort()
 
 	if record.Error != nil {
 		t.Fatalf("sent a http reqeust but was error: %s", record.Error)
@@ -99,23 +101,23 @@ func TestHTTPWithPost(t *testing.T) {
 
 	context := NewContext(config)
 	context.SetInt(FieldContentSize, len(responseStr))
-	jobs := make(chan *http.Request)
+	jobs := make(chan *Job)
 	collector := make(chan *Record)
 
-	worker := NewHTTPWorker(context, jobs, collector)
+	worker := NewHTTPWorker(context, 1, jobs, collector)
 
 	go worker.Run()
 
-	request, err := NewHTTPRequest(config)
+	request, err := NewHTTPRequest(context.work, config)
 
 	if err != nil {
 		t.Fatalf("new http request failed: %s", err)
 	}
 
-	jobs <- request
+	jobs <- &Job{request: request}
 	record := <-collector
 	close(jobs)
-	close(context.stop)
+	context.abort()
 
 	if record.Error != nil {
 		t.Fatalf("sent a http reqeust but was error: %s", record.Error)
@@ -149,22 +151,22 @@ func TestHTTPWorkerWithTimeout(t *testing.T) {
 
 	context := NewContext(config)
 	context.SetInt(FieldContentSize, len(responseStr))
-	jobs := make(chan *http.Request)
+	jobs := make(chan *Job)
 	collector := make(chan *Record)
 
-	worker := NewHTTPWorker(context, jobs, collector)
+	worker := NewHTTPWorker(context, 1, jobs, collector)
 
 	go worker.Run()
 
-	request, err := NewHTTPRequest(config)
+	request, err := NewHTTPRequest(context.work, config)
 	if err != nil {
 		t.Fatalf("new http request failed: %s", err)
 	}
 
-	jobs <- request
+	jobs <- &Job{request: request}
 	record := <-collector
 	close(jobs)
-	close(context.stop)
+	context.abort()
 
 	if record.Error == nil {
 
@@ -173,32 +175,290 @@ func TestHTTPWorkerWithTimeout(t *testing.T) {
 	}
 }
 
+func TestHTTPWorkerWithStopAndAbort(t *testing.T) {
+
+	//fake http server
+	responseStr := "hello"
+	arrived := make(chan struct{}, 2)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		select {
+		case <-time.After(time.Duration(200) * time.Millisecond):
+			w.Write([]byte(responseStr))
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         1,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+
+	// graceful shutdown lets the in-flight request finish
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, len(responseStr))
+	jobs := make(chan *Job, 1)
+	collector := make(chan *Record, 1)
+
+	go NewHTTPWorker(context, 1, jobs, collector).Run()
+
+	request, _ := NewHTTPRequest(context.work, config)
+	jobs <- &Job{request: request}
+	<-arrived
+	context.stop()
+
+	if record := <-collector; record.Error != nil {
+		t.Fatalf("expected in-flight request to finish after stop, but was error: %s", record.Error)
+	}
+	close(jobs)
+	context.abort()
+
+	// hard shutdown cancels the in-flight request and drops its record
+	context = NewContext(config)
+	context.SetInt(FieldContentSize, len(responseStr))
+	jobs = make(chan *Job, 1)
+	collector = make(chan *Record, 1)
+	done := make(chan struct{})
+
+	go func() {
+		NewHTTPWorker(context, 1, jobs, collector).Run()
+		close(done)
+	}()
+
+	request, _ = NewHTTPRequest(context.work, config)
+	jobs <- &Job{request: request}
+	<-arrived
+	context.abort()
+	close(jobs)
+
+	select {
+	case <-done:
+	case <-time.After(time.Duration(100) * time.Millisecond):
+		t.Fatal("expected worker to return after abort")
+	}
+
+	if len(collector) != 0 {
+		t.Fatal("expected aborted request not to be collected")
+	}
+}
+
+func TestNewHTTPRequestWithMethods(t *testing.T) {
+
+	// a bodiless request has no content type
+	request, err := NewHTTPRequest(context.Background(), getRequestConfig)
+	if err != nil {
+		t.Fatalf("new http request failed: %s", err)
+	}
+	if _, ok := request.Header["Content-Type"]; ok || request.Body != nil {
+		t.Fatal("expected GET request without body and content type")
+	}
+
+	// any method can carry a body
+	config := &Config{
+		url:         "http://localhost/",
+		method:      "DELETE",
+		contentType: "application/json",
+		bodyContent: []byte(`{"id": 1}`),
+	}
+
+	request, err = NewHTTPRequest(context.Background(), config)
+	if err != nil {
+		t.Fatalf("new http request failed: %s", err)
+	}
+	if request.Method != "DELETE" || request.ContentLength != int64(len(config.bodyContent)) || request.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected DELETE request with json body, got %s with %d bytes of %s", request.Method, request.ContentLength, request.Header.Get("Content-Type"))
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	testData := map[string][2]string{
+		"Referer: http://localhost:8080/path": {"Referer", "http://localhost:8080/path"},
+		"accept-encoding:gzip":                {"Accept-Encoding", "gzip"},
+		"  X-Empty :  ":                       {"X-Empty", ""},
+	}
+
+	for testingData, expectedData := range testData {
+		name, value, err := ParseHeader(testingData)
+		if err != nil || name != expectedData[0] || value != expectedData[1] {
+			t.Errorf("expected %q and %q for %q, got %q and %q (%v)", expectedData[0], expectedData[1], testingData, name, value, err)
+		}
+	}
+
+	for _, testingData := range []string{"Referer", ": value", "Bad Name: value"} {
+		if _, _, err := ParseHeader(testingData); err == nil {
+			t.Errorf("expected error for %q", testingData)
+		}
+	}
+}
+
+func TestParseCookie(t *testing.T) {
+	name, value, err := ParseCookie(" token = YWJjZA== ")
+	if err != nil || name != "token" || value != "YWJjZA==" {
+		t.Fatalf("expected token and YWJjZA==, got %q and %q (%v)", name, value, err)
+	}
+
+	for _, testingData := range []string{"token", "=value"} {
+		if _, _, err := ParseCookie(testingData); err == nil {
+			t.Errorf("expected error for %q", testingData)
+		}
+	}
+}
+
+func TestParseBasicAuthentication(t *testing.T) {
+	username, password, err := ParseBasicAuthentication("user:pa:ss")
+	if err != nil || username != "user" || password != "pa:ss" {
+		t.Fatalf("expected user and pa:ss, got %q and %q (%v)", username, password, err)
+	}
+
+	if _, _, err := ParseBasicAuthentication("secret"); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("expected error without the value for a missing separator, got %v", err)
+	}
+}
+
+func TestNewHTTPRequestWithHeaders(t *testing.T) {
+	config := &Config{
+		url:                 "http://localhost/",
+		method:              "GET",
+		contentType:         "text/plain",
+		userAgent:           "GoHttpBench/" + GBVersion,
+		headers:             []string{"User-Agent: custom", "Content-Type:", "Accept: a", "Accept: b", "Host: example.com"},
+		cookies:             []string{"token=YWJjZA=="},
+		basicAuthentication: "user:pa:ss",
+	}
+
+	request, err := NewHTTPRequest(context.Background(), config)
+	if err != nil {
+		t.Fatalf("new http request failed: %s", err)
+	}
+
+	if ua := request.Header.Get("User-Agent"); ua != "custom" {
+		t.Errorf("expected user agent to be overridden, got %q", ua)
+	}
+
+	if _, ok := request.Header["Content-Type"]; ok {
+		t.Error("expected content type to be removed")
+	}
+
+	if accept := request.Header["Accept"]; len(accept) != 2 {
+		t.Errorf("expected repeated header to be added, got %v", accept)
+	}
+
+	if request.Host != "example.com" {
+		t.Errorf("expected host to be overridden, got %q", request.Host)
+	}
+
+	if cookie, err := request.Cookie("token"); err != nil || cookie.Value != "YWJjZA==" {
+		t.Errorf("expected cookie value YWJjZA==, got %v (%v)", cookie, err)
+	}
+
+	if username, password, ok := request.BasicAuth(); !ok || username != "user" || password != "pa:ss" {
+		t.Errorf("expected user and pa:ss, got %q and %q", username, password)
+	}
+}
+
 func BenchmarkNewHTTPRequestWithGet(b *testing.B) {
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		NewHTTPRequest(getRequestConfig)
+		NewHTTPRequest(context.Background(), getRequestConfig)
 	}
 }
 
 func BenchmarkNewHTTPRequestWithPost(b *testing.B) {
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		NewHTTPRequest(postRequestConfig)
+		NewHTTPRequest(context.Background(), postRequestConfig)
 	}
 }
 
 func BenchmarkCopyHTTPRequestWithGet(b *testing.B) {
 	b.ReportAllocs()
-	base, _ := NewHTTPRequest(getRequestConfig)
+	base, _ := NewHTTPRequest(context.Background(), getRequestConfig)
 	for i := 0; i < b.N; i++ {
-		CopyHTTPRequest(getRequestConfig, base)
+		CopyHTTPRequest(base)
 	}
 }
 
 func BenchmarkCopyHTTPRequestWithPost(b *testing.B) {
 	b.ReportAllocs()
-	base, _ := NewHTTPRequest(postRequestConfig)
+	base, _ := NewHTTPRequest(context.Background(), postRequestConfig)
 	for i := 0; i < b.N; i++ {
-		CopyHTTPRequest(postRequestConfig, base)
+		CopyHTTPRequest(base)
+	}
+}
+
+func TestHTTPWithProtocols(t *testing.T) {
+	responseStr := "hello"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(responseStr))
+	})
+
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	plainServer := httptest.NewUnstartedServer(handler)
+	plainServer.Config.Protocols = new(http.Protocols)
+	plainServer.Config.Protocols.SetHTTP1(true)
+	plainServer.Config.Protocols.SetUnencryptedHTTP2(true)
+	plainServer.Start()
+	defer plainServer.Close()
+
+	testData := []struct {
+		url       string
+		protocol  string
+		tlsResume bool
+		expected  string
+	}{
+		{tlsServer.URL, ProtocolHTTP1, false, "HTTP/1.1"},
+		{tlsServer.URL, ProtocolHTTP2, true, "HTTP/2.0"},
+		{plainServer.URL, ProtocolHTTP2, false, "HTTP/2.0"},
+	}
+
+	for _, data := range testData {
+		config := &Config{
+			concurrency:      1,
+			requests:         2,
+			method:           "GET",
+			executionTimeout: MaxExecutionTimeout,
+			url:              data.url,
+			protocol:         data.protocol,
+			tlsResume:        data.tlsResume,
+		}
+
+		context := NewContext(config)
+		context.SetInt(FieldContentSize, len(responseStr))
+		benchmark := NewBenchmark(context)
+
+		go benchmark.Run()
+
+		var records []*Record
+		for record := range benchmark.collector {
+			if record.Error != nil {
+				t.Fatalf("sent a %s reqeust but was error: %s", data.protocol, record.Error)
+			}
+			if record.protocol != data.expected {
+				t.Fatalf("expected %s to %s, got %s", data.protocol, data.url, record.protocol)
+			}
+			records = append(records, record)
+		}
+		context.abort()
+
+		// without keepalive every request makes a new connection
+		tls := strings.HasPrefix(data.url, "https")
+		for i, record := range records {
+			if (record.tlsHandshake > 0) != tls {
+				t.Fatalf("expected a TLS handshake to be %t, got %s", tls, record.tlsHandshake)
+			}
+			// the session of the first connection is resumed by the second
+			if data.tlsResume && record.tlsResumed != (i > 0) {
+				t.Fatalf("expected request %d to resume a TLS session to be %t", i, i > 0)
+			}
+		}
 	}
 }
@@ -12,26 +12,36 @@ import (
 const (
 	GBVersion           = "0.1.9"
 	MaxExecutionTimeout = time.Duration(30) * time.Second
-	MaxRequests         = 50000 // for timelimit
-)
-
-var (
-	Verbosity       = 0
-	GoMaxProcs      int
-	ContinueOnError bool
 )
 
 func main() {
 	if config, err := LoadConfig(); err != nil {
+		if err == flag.ErrHelp {
+			flag.CommandLine.Usage()
+			os.Exit(0)
+		}
 		fmt.Println(err)
-		flag.Usage()
+		flag.CommandLine.Usage()
 		os.Exit(-1)
+	} else if config.agent != "" {
+		// benchmarks of coordinators share the processors given to the agent
+		runtime.GOMAXPROCS(config.goMaxProcs)
+		log.Fatal(RunAgent(config))
+	} else if len(config.agents) > 0 {
+		startDistributedBenchmark(NewContext(config))
 	} else {
 		context := NewContext(config)
+		if config.metrics != "" {
+			metrics := NewMetrics()
+			if err := ServeMetrics(config.metrics, metrics); err != nil {
+				log.Fatal(err)
+			}
+			metrics.Attach(context)
+		}
 		if err := DetectHost(context); err != nil {
 			log.Fatal(err)
 		} else {
-			runtime.GOMAXPROCS(GoMaxProcs)
+			runtime.GOMAXPROCS(config.goMaxProcs)
 			startBenchmark(context)
 		}
 	}
@@ -45,5 +55,28 @@ func startBenchmark(context *Context) {
 	go monitor.Run()
 	go benchmark.Run()
 
-	PrintReport(context, <-monitor.output)
+	report(context, <-monitor.output)
+}
+
+func startDistributedBenchmark(context *Context) {
+	PrintHeader()
+
+	stats, err := Distribute(context)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report(context, stats)
+}
+
+// report prints the results and writes them as HTML when asked to
+func report(context *Context, stats *Stats) {
+	PrintReport(context, stats)
+
+	if context.config.htmlReport != "" {
+		if err := WriteHTMLReport(context, stats, context.config.htmlReport); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("HTML report written to %s\n", context.config.htmlReport)
+	}
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// metricsBuckets are the upper bounds of the response time histogram in
+// seconds, the default buckets of Prometheus clients
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricsErrors are the types of failed requests, as in the report
+var metricsErrors = []string{"connect", "ports", "receive", "length", "response", "extract", "exception"}
+
+// Metrics are fed with the records of the monitor and exposed in the
+// Prometheus text format. Counters carry on over the benchmarks of an agent
+type Metrics struct {
+	mu sync.Mutex
+	c  *Context // of the running benchmark, for the gauges
+
+	requests      map[string]int64 // by status code
+	errors        map[string]int64 // by type
+	received      int64
+	sent          int64
+	wireReceived  int64
+	wireSent      int64
+	buckets       []int64 // per metricsBuckets, not cumulative
+	responseCount int64
+	responseSum   float64 // seconds
+}
+
+func NewMetrics() *Metrics {
+	metrics := &Metrics{
+		requests: make(map[string]int64),
+		errors:   make(map[string]int64),
+		buckets:  make([]int64, len(metricsBuckets)),
+	}
+	for _, errorType := range metricsErrors {
+		metrics.errors[errorType] = 0
+	}
+	return metrics
+}
+
+// ServeMetrics exposes metrics at /metrics on addr, in the background once
+// it is listening
+func ServeMetrics(addr string, metrics *Metrics) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go http.Serve(listener, mux)
+	return nil
+}
+
+// Attach feeds the metrics with the benchmark of context
+func (m *Metrics) Attach(context *Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.c = context
+	context.metrics = m
+}
+
+func (m *Metrics) Observe(record *Record) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	code := "none"
+	if record.status > 0 {
+		code = strconv.Itoa(record.status)
+	}
+	m.requests[code]++
+	m.received += record.contentSize
+	m.sent += record.bodySent
+	m.wireReceived += record.wireReceived
+	m.wireSent += record.wireSent
+
+	if record.Error != nil {
+		m.errors[metricsErrorType(record.Error)]++
+		return
+	}
+
+	seconds := record.responseTime.Seconds()
+	for i, bound := range metricsBuckets {
+		if seconds <= bound {
+			m.buckets[i]++
+			break
+		}
+	}
+	m.responseCount++
+	m.responseSum += seconds
+}
+
+func metricsErrorType(err error) string {
+	switch err.(type) {
+	case *ConnectError:
+		return "connect"
+	case *PortExhaustedError:
+		return "ports"
+	case *LengthError:
+		return "length"
+	case *ReceiveError:
+		return "receive"
+	case *ResponseError, *GRPCError:
+		return "response"
+	case *ExtractError:
+		return "extract"
+	}
+	return "exception"
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buffer bytes.Buffer
+
+	m.mu.Lock()
+	fprintMetric(&buffer, "gb_requests_total", "counter", "Requests completed by the status code of the response, none when no response was received", "code", m.requests)
+	fprintMetric(&buffer, "gb_errors_total", "counter", "Failed requests by type", "type", m.errors)
+	fprintMetric(&buffer, "gb_received_bytes_total", "counter", "Bytes of response bodies received", "", map[string]int64{"": m.received})
+	fprintMetric(&buffer, "gb_sent_bytes_total", "counter", "Bytes of request bodies sent", "", map[string]int64{"": m.sent})
+	fprintMetric(&buffer, "gb_network_received_bytes_total", "counter", "Bytes received on the wire including headers", "", map[string]int64{"": m.wireReceived})
+	fprintMetric(&buffer, "gb_network_sent_bytes_total", "counter", "Bytes sent on the wire including headers", "", map[string]int64{"": m.wireSent})
+
+	var inflight, workers int64
+	if m.c != nil {
+		inflight, workers = int64(m.c.Inflight()), int64(m.c.Workers())
+	}
+	fprintMetric(&buffer, "gb_inflight_requests", "gauge", "Requests being sent", "", map[string]int64{"": inflight})
+	fprintMetric(&buffer, "gb_active_workers", "gauge", "Concurrent users running", "", map[string]int64{"": workers})
+
+	fmt.Fprintln(&buffer, "# HELP gb_response_time_seconds Response times of successful requests")
+	fmt.Fprintln(&buffer, "# TYPE gb_response_time_seconds histogram")
+	var cumulative int64
+	for i, bound := range metricsBuckets {
+		cumulative += m.buckets[i]
+		fmt.Fprintf(&buffer, "gb_response_time_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(&buffer, "gb_response_time_seconds_bucket{le=\"+Inf\"} %d\n", m.responseCount)
+	fmt.Fprintf(&buffer, "gb_response_time_seconds_sum %s\n", strconv.FormatFloat(m.responseSum, 'g', -1, 64))
+	fmt.Fprintf(&buffer, "gb_response_time_seconds_count %d\n", m.responseCount)
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buffer.Bytes())
+}
+
+// fprintMetric prints a metric with a sample per label value, a metric
+// without label has a single sample of the empty label value
+func fprintMetric(buffer *bytes.Buffer, name, metricType, help, label string, samples map[string]int64) {
+	fmt.Fprintf(buffer, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buffer, "# TYPE %s %s\n", name, metricType)
+
+	if label == "" {
+		fmt.Fprintf(buffer, "%s %d\n", name, samples[""])
+		return
+	}
+
+	var values []string
+	for value := range samples {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		fmt.Fprintf(buffer, "%s{%s=%q} %d\n", name, label, value, samples[value])
+	}
+}
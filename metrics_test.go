@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.Observe(&Record{status: 200, responseTime: 3 * time.Millisecond, contentSize: 10, wireReceived: 80})
+	metrics.Observe(&Record{status: 200, responseTime: 20 * time.Second, contentSize: 10, wireReceived: 80})
+	metrics.Observe(&Record{status: 503, Error: &ResponseError{errors.New("unavailable")}})
+	metrics.Observe(&Record{Error: &ConnectError{errors.New("refused")}})
+
+	ts := httptest.NewServer(metrics)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Fatalf("expected the Prometheus text format, got %q", contentType)
+	}
+	for _, line := range []string{
+		"# TYPE gb_requests_total counter",
+		`gb_requests_total{code="200"} 2`,
+		`gb_requests_total{code="503"} 1`,
+		`gb_requests_total{code="none"} 1`,
+		`gb_errors_total{type="connect"} 1`,
+		`gb_errors_total{type="length"} 0`,
+		`gb_errors_total{type="response"} 1`,
+		"gb_received_bytes_total 20",
+		"gb_network_received_bytes_total 160",
+		"gb_inflight_requests 0",
+		"# TYPE gb_response_time_seconds histogram",
+		`gb_response_time_seconds_bucket{le="0.005"} 1`,
+		`gb_response_time_seconds_bucket{le="10"} 1`,
+		`gb_response_time_seconds_bucket{le="+Inf"} 2`,
+		"gb_response_time_seconds_sum 20.003",
+		"gb_response_time_seconds_count 2",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("expected %q in the metrics, got\n%s", line, body)
+		}
+	}
+}
+
+func TestMonitorWithMetrics(t *testing.T) {
+	config := &Config{
+		requests: 2,
+	}
+
+	collector := make(chan *Record, config.requests)
+	collector <- &Record{status: 200, responseTime: 10}
+	collector <- &Record{status: 200, responseTime: 20}
+	close(collector)
+
+	context := NewContext(config)
+	metrics := NewMetrics()
+	metrics.Attach(context)
+
+	devnull, _ := os.Open(os.DevNull)
+	defer devnull.Close()
+	stdout := os.Stdout
+	os.Stdout = devnull
+
+	monitor := NewMonitor(context, collector)
+	go monitor.Run()
+	<-monitor.output
+
+	os.Stdout = stdout
+	if metrics.requests["200"] != 2 || metrics.responseCount != 2 {
+		t.Fatalf("expected 2 requests fed by the monitor, got %d", metrics.requests["200"])
+	}
+}
@@ -4,49 +4,122 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 )
 
+// Monitor collects the records of the http workers into stats, the
+// collector has to be closed once the workers have returned
 type Monitor struct {
 	c         *Context
 	collector chan *Record
 	output    chan *Stats
+	signals   chan os.Signal
 }
 
 type Stats struct {
-	responseTimeData []time.Duration
+	responseTimes Histogram
 
 	totalRequests       int
 	totalExecutionTime  time.Duration
 	totalResponseTime   time.Duration
 	totalReceived       int64
+	totalSent           int64
+	totalTransferred    int64 // bytes on the wire including headers
+	totalWireSent       int64
+	totalDecoded        int64
+	totalDecodeTime     time.Duration
+	encodings           map[string]int // responses by Content-Encoding
 	totalFailedReqeusts int
 
+	proxyConnects Histogram     // per new connection through a proxy
+	tcpInfo       *TCPInfoStats // of connections closed during the benchmark
+	tlsHandshakes Histogram     // per new TLS connection
+	tlsResumed    int
+	upgrades      Histogram      // per websocket handshake
+	grpcStatuses  map[string]int // calls by gRPC status
+	totalEvents   int
+	firstEvents   Histogram // per streamed response with events
+	eventGaps     Histogram
+	protocols     map[string]int // responses by protocol
+	statusCodes   map[string]int // responses by HTTP status code
+
+	interrupted     bool
+	drainedRequests int
+	abortedRequests int
+
 	errLength    int
 	errConnect   int
+	errPorts     int
 	errReceive   int
 	errException int
 	errResponse  int
+	errExtract   int
+
+	steps     []*StepStats             // per step of a scenario, in order
+	addresses map[string]*AddressStats // per remote ip
+	agents    []*AgentStats            // per agent of a distributed benchmark
+	timeline  []*SecondStats           // per second of the benchmark, in order
+}
+
+type StepStats struct {
+	name          string
+	responseTimes Histogram
+
+	totalRequests       int
+	totalFailedReqeusts int
+}
+
+type AddressStats struct {
+	responseTimes Histogram
+
+	totalRequests       int
+	totalFailedReqeusts int
+}
+
+// SecondStats are the requests completed within a second of the benchmark
+type SecondStats struct {
+	responseTimes Histogram
+
+	totalRequests       int
+	totalFailedReqeusts int
+}
+
+type AgentStats struct {
+	name          string
+	responseTimes Histogram
+
+	totalRequests       int
+	totalExecutionTime  time.Duration
+	totalFailedReqeusts int
 }
 
 func NewMonitor(context *Context, collector chan *Record) *Monitor {
-	return &Monitor{context, collector, make(chan *Stats)}
+	return &Monitor{context, collector, make(chan *Stats), make(chan os.Signal, 2)}
 }
 
 func (m *Monitor) Run() {
 
-	// catch interrupt signal
-	userInterrupt := make(chan os.Signal, 1)
-	signal.Notify(userInterrupt, os.Interrupt)
+	// catch interrupt and termination signals
+	signal.Notify(m.signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(m.signals)
 
-	stats := &Stats{}
-	stats.responseTimeData = make([]time.Duration, 0, m.c.config.requests)
+	var drain <-chan time.Time
 
-	var timelimiter <-chan time.Time
-	if m.c.config.timelimit > 0 {
-		t := time.NewTimer(time.Duration(m.c.config.timelimit) * time.Second)
+	// report progress in time for runs bounded by the time limit only
+	var progress <-chan time.Time
+	if m.c.config.requests == 0 {
+		t := time.NewTicker(time.Duration(m.c.config.timelimit) * time.Second / 10)
 		defer t.Stop()
-		timelimiter = t.C
+		progress = t.C
+	}
+
+	stats := &Stats{}
+	if m.c.config.scenario != nil {
+		for _, step := range m.c.config.scenario.Steps {
+			stats.steps = append(stats.steps, &StepStats{name: step.Name})
+		}
 	}
 
 	// waiting for all of http workers to start
@@ -55,19 +128,36 @@ func (m *Monitor) Run() {
 	fmt.Printf("Benchmarking %s (be patient)\n", m.c.config.host)
 	sw := &StopWatch{}
 	sw.Start()
+	if m.c.pusher != nil {
+		m.c.pusher.Start()
+	}
 
 loop:
 	for {
 		select {
-		case record := <-m.collector:
+		case record, ok := <-m.collector:
+			if !ok {
+				// all of http workers have returned
+				break loop
+			}
 
 			updateStats(stats, record)
+			updateTimeline(stats, time.Since(sw.start), record)
+			if m.c.metrics != nil {
+				m.c.metrics.Observe(record)
+			}
+			if m.c.pusher != nil {
+				m.c.pusher.Observe(record)
+			}
+			if stats.interrupted {
+				stats.drainedRequests++
+			}
 
-			if record.Error != nil && !ContinueOnError {
+			if record.Error != nil && !m.c.config.continueOnError {
 				break loop
 			}
 
-			if stats.totalRequests >= 10 && stats.totalRequests%(m.c.config.requests/10) == 0 {
+			if m.c.config.requests > 0 && stats.totalRequests >= 10 && stats.totalRequests%(m.c.config.requests/10) == 0 {
 				fmt.Printf("Completed %d requests\n", stats.totalRequests)
 			}
 
@@ -76,24 +166,115 @@ loop:
 				break loop
 			}
 
-		case <-timelimiter:
+		case <-progress:
+			fmt.Printf("Elapsed %.1f of %d seconds, completed %d requests\n", time.Since(sw.start).Seconds(), m.c.config.timelimit, stats.totalRequests)
+
+		case <-m.c.work.Done():
+			// time limit reached
+			if m.c.config.requests == 0 {
+				fmt.Printf("Finished after %d seconds, %d requests\n", m.c.config.timelimit, stats.totalRequests)
+			}
 			break loop
-		case <-userInterrupt:
+		case <-m.signals:
+			if stats.interrupted {
+				// second interrupt, abort in-flight requests
+				break loop
+			}
+
+			// first interrupt, stop issuing new jobs and wait for in-flight requests to finish
+			stats.interrupted = true
+			fmt.Printf("Interrupted, waiting up to %s for %d in-flight requests (interrupt again to abort)\n", m.c.config.executionTimeout, m.c.Inflight())
+			m.c.stop()
+
+			t := time.NewTimer(m.c.config.executionTimeout)
+			defer t.Stop()
+			drain = t.C
+
+		case <-drain:
 			break loop
 		}
 	}
 
 	sw.Stop()
 	stats.totalExecutionTime = sw.Elapsed
+	if m.c.pusher != nil {
+		m.c.pusher.Stop()
+	}
+
+	if stats.interrupted {
+		stats.abortedRequests = m.c.Inflight()
+	}
+
+	// shutdown benchmark and all of httpworkers to stop, the collector is
+	// closed once they have returned and closed their kept alive connections
+	m.c.abort()
+	for range m.collector {
+	}
+	stats.tcpInfo = m.c.tcpInfo.Snapshot()
 
-	// shutdown benchmark and all of httpworkers to stop
-	close(m.c.stop)
-	signal.Stop(userInterrupt)
 	m.output <- stats
 }
 
 func updateStats(stats *Stats, record *Record) {
 	stats.totalRequests++
+	stats.totalSent += record.bodySent
+	stats.totalTransferred += record.wireReceived
+	stats.totalWireSent += record.wireSent
+	if record.proxyConnect > 0 {
+		stats.proxyConnects.Record(record.proxyConnect)
+	}
+	if record.tlsHandshake > 0 {
+		stats.tlsHandshakes.Record(record.tlsHandshake)
+		if record.tlsResumed {
+			stats.tlsResumed++
+		}
+	}
+	if record.events > 0 {
+		stats.totalEvents += record.events
+		stats.firstEvents.Record(record.firstEvent)
+		for _, gap := range record.eventGaps {
+			stats.eventGaps.Record(gap)
+		}
+	}
+	if record.grpcStatus != "" {
+		if stats.grpcStatuses == nil {
+			stats.grpcStatuses = make(map[string]int)
+		}
+		stats.grpcStatuses[record.grpcStatus]++
+	}
+	if record.upgrade > 0 {
+		stats.upgrades.Record(record.upgrade)
+	}
+	if record.protocol != "" {
+		if stats.protocols == nil {
+			stats.protocols = make(map[string]int)
+		}
+		stats.protocols[record.protocol]++
+	}
+
+	if record.status > 0 {
+		if stats.statusCodes == nil {
+			stats.statusCodes = make(map[string]int)
+		}
+		stats.statusCodes[strconv.Itoa(record.status)]++
+	}
+
+	if record.remoteIP != "" {
+		if stats.addresses == nil {
+			stats.addresses = make(map[string]*AddressStats)
+		}
+		addressStats, ok := stats.addresses[record.remoteIP]
+		if !ok {
+			addressStats = &AddressStats{}
+			stats.addresses[record.remoteIP] = addressStats
+		}
+		addressStats.totalRequests++
+		if record.Error != nil {
+			addressStats.totalFailedReqeusts++
+		} else {
+			addressStats.responseTimes.Record(record.responseTime)
+		}
+	}
 
 	if record.Error != nil {
 		stats.totalFailedReqeusts++
@@ -101,14 +282,18 @@ func updateStats(stats *Stats, record *Record) {
 		switch record.Error.(type) {
 		case *ConnectError:
 			stats.errConnect++
+		case *PortExhaustedError:
+			stats.errPorts++
 		case *ExceptionError:
 			stats.errException++
 		case *LengthError:
 			stats.errLength++
 		case *ReceiveError:
 			stats.errReceive++
-		case *ResponseError:
+		case *ResponseError, *GRPCError:
 			stats.errResponse++
+		case *ExtractError:
+			stats.errExtract++
 		default:
 			stats.errException++
 		}
@@ -116,7 +301,140 @@ func updateStats(stats *Stats, record *Record) {
 	} else {
 		stats.totalResponseTime += record.responseTime
 		stats.totalReceived += record.contentSize
-		stats.responseTimeData = append(stats.responseTimeData, record.responseTime)
+		stats.totalDecoded += record.decodedSize
+		stats.totalDecodeTime += record.decodeTime
+		if record.encoding != "" {
+			if stats.encodings == nil {
+				stats.encodings = make(map[string]int)
+			}
+			stats.encodings[record.encoding]++
+		}
+		stats.responseTimes.Record(record.responseTime)
+	}
+
+	for i, step := range record.steps {
+		if i >= len(stats.steps) {
+			break
+		}
+		stepStats := stats.steps[i]
+		stepStats.totalRequests++
+		if step.Error != nil {
+			stepStats.totalFailedReqeusts++
+		} else {
+			stepStats.responseTimes.Record(step.responseTime)
+		}
+	}
+}
+
+// updateTimeline adds a record to the second of the benchmark it completed
+// in, elapsed since the start
+func updateTimeline(stats *Stats, elapsed time.Duration, record *Record) {
+	second := int(elapsed / time.Second)
+	for len(stats.timeline) <= second {
+		stats.timeline = append(stats.timeline, &SecondStats{})
+	}
+
+	secondStats := stats.timeline[second]
+	secondStats.totalRequests++
+	if record.Error != nil {
+		secondStats.totalFailedReqeusts++
+	} else {
+		secondStats.responseTimes.Record(record.responseTime)
 	}
+}
+
+// Merge adds the stats of a benchmark that ran alongside, the execution
+// time is the longest of both
+func (s *Stats) Merge(other *Stats) {
+	s.responseTimes.Merge(&other.responseTimes)
 
+	s.totalRequests += other.totalRequests
+	if other.totalExecutionTime > s.totalExecutionTime {
+		s.totalExecutionTime = other.totalExecutionTime
+	}
+	s.totalResponseTime += other.totalResponseTime
+	s.totalReceived += other.totalReceived
+	s.totalSent += other.totalSent
+	s.totalTransferred += other.totalTransferred
+	s.totalWireSent += other.totalWireSent
+	s.totalDecoded += other.totalDecoded
+	s.totalDecodeTime += other.totalDecodeTime
+	s.encodings = mergeCounts(s.encodings, other.encodings)
+	s.totalFailedReqeusts += other.totalFailedReqeusts
+
+	s.proxyConnects.Merge(&other.proxyConnects)
+	if other.tcpInfo != nil {
+		if s.tcpInfo == nil {
+			s.tcpInfo = &TCPInfoStats{}
+		}
+		s.tcpInfo.Merge(other.tcpInfo)
+	}
+	s.tlsHandshakes.Merge(&other.tlsHandshakes)
+	s.tlsResumed += other.tlsResumed
+	s.upgrades.Merge(&other.upgrades)
+	s.grpcStatuses = mergeCounts(s.grpcStatuses, other.grpcStatuses)
+	s.totalEvents += other.totalEvents
+	s.firstEvents.Merge(&other.firstEvents)
+	s.eventGaps.Merge(&other.eventGaps)
+	s.protocols = mergeCounts(s.protocols, other.protocols)
+	s.statusCodes = mergeCounts(s.statusCodes, other.statusCodes)
+
+	s.interrupted = s.interrupted || other.interrupted
+	s.drainedRequests += other.drainedRequests
+	s.abortedRequests += other.abortedRequests
+
+	s.errLength += other.errLength
+	s.errConnect += other.errConnect
+	s.errPorts += other.errPorts
+	s.errReceive += other.errReceive
+	s.errException += other.errException
+	s.errResponse += other.errResponse
+	s.errExtract += other.errExtract
+
+	for i, step := range other.steps {
+		if i >= len(s.steps) {
+			s.steps = append(s.steps, &StepStats{name: step.name})
+		}
+		stepStats := s.steps[i]
+		stepStats.responseTimes.Merge(&step.responseTimes)
+		stepStats.totalRequests += step.totalRequests
+		stepStats.totalFailedReqeusts += step.totalFailedReqeusts
+	}
+
+	for address, addressStats := range other.addresses {
+		if s.addresses == nil {
+			s.addresses = make(map[string]*AddressStats)
+		}
+		merged, ok := s.addresses[address]
+		if !ok {
+			merged = &AddressStats{}
+			s.addresses[address] = merged
+		}
+		merged.responseTimes.Merge(&addressStats.responseTimes)
+		merged.totalRequests += addressStats.totalRequests
+		merged.totalFailedReqeusts += addressStats.totalFailedReqeusts
+	}
+
+	// agents start together, their timelines are aligned
+	for i, secondStats := range other.timeline {
+		if i >= len(s.timeline) {
+			s.timeline = append(s.timeline, &SecondStats{})
+		}
+		merged := s.timeline[i]
+		merged.responseTimes.Merge(&secondStats.responseTimes)
+		merged.totalRequests += secondStats.totalRequests
+		merged.totalFailedReqeusts += secondStats.totalFailedReqeusts
+	}
+
+	s.agents = append(s.agents, other.agents...)
+}
+
+func mergeCounts(counts map[string]int, other map[string]int) map[string]int {
+	if len(other) > 0 && counts == nil {
+		counts = make(map[string]int)
+	}
+	for key, count := range other {
+		counts[key] += count
+	}
+	return counts
 }
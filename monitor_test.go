@@ -3,6 +3,8 @@ package main
 import (
 	"errors"
 	"os"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -18,11 +20,12 @@ func TestMonitorWithSuccessedResponse(t *testing.T) {
 	context := NewContext(config)
 	monitor := NewMonitor(context, collector)
 
-	request1 := &Record{10, 10, nil}
-	request2 := &Record{20, 20, nil}
+	request1 := &Record{responseTime: 10, contentSize: 10}
+	request2 := &Record{responseTime: 20, contentSize: 20}
 
 	collector <- request1
 	collector <- request2
+	close(collector)
 
 	devnull, _ := os.Open(os.DevNull)
 	defer devnull.Close()
@@ -38,8 +41,8 @@ func TestMonitorWithSuccessedResponse(t *testing.T) {
 		t.Fatalf("expected %d requests, actual %d requests", config.requests, stats.totalRequests)
 	}
 
-	if stats.responseTimeData[0] != request1.responseTime || stats.responseTimeData[1] != request2.responseTime {
-		t.Fatalf("expected %s responseTimeData, actual %s responseTimeData", []time.Duration{request1.responseTime, request2.responseTime}, stats.responseTimeData)
+	if stats.responseTimes.Min() != request1.responseTime || stats.responseTimes.Max() != request2.responseTime {
+		t.Fatalf("expected %s response times, actual %s", []time.Duration{request1.responseTime, request2.responseTime}, []time.Duration{stats.responseTimes.Min(), stats.responseTimes.Max()})
 	}
 
 	if stats.totalReceived != request1.contentSize+request2.contentSize {
@@ -49,10 +52,9 @@ func TestMonitorWithSuccessedResponse(t *testing.T) {
 
 func TestMonitorWithFailedResponse(t *testing.T) {
 
-	ContinueOnError = true
-
 	config := &Config{
-		requests: 6,
+		requests:        6,
+		continueOnError: true,
 	}
 
 	collector := make(chan *Record, config.requests)
@@ -84,6 +86,7 @@ func TestMonitorWithFailedResponse(t *testing.T) {
 	for _, record := range records {
 		collector <- record
 	}
+	close(collector)
 
 	devnull, _ := os.Open(os.DevNull)
 	defer devnull.Close()
@@ -106,3 +109,128 @@ func TestMonitorWithFailedResponse(t *testing.T) {
 	}
 
 }
+
+func TestMonitorWithInterrupt(t *testing.T) {
+
+	config := &Config{
+		requests:         10,
+		executionTimeout: time.Duration(50) * time.Millisecond,
+	}
+
+	collector := make(chan *Record, config.requests)
+
+	context := NewContext(config)
+	monitor := NewMonitor(context, collector)
+
+	// two requests are in-flight when interrupted, one of them finishes during the drain
+	atomic.StoreInt64(&context.inflight, 2)
+	monitor.signals <- os.Interrupt
+
+	go func() {
+		<-context.jobs.Done()
+		collector <- &Record{responseTime: 10, contentSize: 10}
+		atomic.StoreInt64(&context.inflight, 1)
+		<-context.work.Done()
+		close(collector)
+	}()
+
+	devnull, _ := os.Open(os.DevNull)
+	defer devnull.Close()
+
+	stdout := os.Stdout
+	os.Stdout = devnull
+
+	go monitor.Run()
+	stats := <-monitor.output
+	os.Stdout = stdout
+
+	if !stats.interrupted || stats.drainedRequests != 1 || stats.abortedRequests != 1 {
+		t.Fatalf("expected an interrupted run with 1 drained and 1 aborted request, actual %#+v", stats)
+	}
+
+	if context.work.Err() == nil {
+		t.Fatal("expected in-flight requests to be aborted after the drain timeout")
+	}
+}
+
+func TestMonitorWithSecondInterrupt(t *testing.T) {
+
+	config := &Config{
+		requests:         10,
+		executionTimeout: MaxExecutionTimeout,
+	}
+
+	collector := make(chan *Record, config.requests)
+
+	context := NewContext(config)
+	monitor := NewMonitor(context, collector)
+
+	atomic.StoreInt64(&context.inflight, 3)
+	monitor.signals <- os.Interrupt
+	monitor.signals <- syscall.SIGTERM
+
+	// no worker is left to return
+	go func() {
+		<-context.work.Done()
+		close(collector)
+	}()
+
+	devnull, _ := os.Open(os.DevNull)
+	defer devnull.Close()
+
+	stdout := os.Stdout
+	os.Stdout = devnull
+
+	go monitor.Run()
+
+	var stats *Stats
+	select {
+	case stats = <-monitor.output:
+	case <-time.After(time.Second):
+		t.Fatal("expected second interrupt to abort without waiting for the drain")
+	}
+	os.Stdout = stdout
+
+	if !stats.interrupted || stats.abortedRequests != 3 {
+		t.Fatalf("expected an interrupted run with 3 aborted requests, actual %#+v", stats)
+	}
+}
+
+func TestStatsMerge(t *testing.T) {
+	first, second := &Stats{}, &Stats{}
+	records := []*Record{
+		{status: 200, responseTime: 10, contentSize: 10, remoteIP: "127.0.0.1", protocol: "HTTP/1.1"},
+		{status: 200, responseTime: 30, contentSize: 20, remoteIP: "127.0.0.1", protocol: "HTTP/1.1"},
+		{Error: &ConnectError{errors.New("refused")}, remoteIP: "127.0.0.2"},
+	}
+	updateStats(first, records[0])
+	updateTimeline(first, 0, records[0])
+	updateStats(second, records[1])
+	updateTimeline(second, 1500*time.Millisecond, records[1])
+	updateStats(second, records[2])
+	updateTimeline(second, 1600*time.Millisecond, records[2])
+	first.totalExecutionTime, second.totalExecutionTime = time.Second, 2*time.Second
+
+	merged := &Stats{}
+	merged.Merge(first)
+	merged.Merge(second)
+
+	if merged.totalRequests != 3 || merged.totalFailedReqeusts != 1 || merged.errConnect != 1 || merged.totalReceived != 30 {
+		t.Fatalf("expected 3 requests with 1 failed and 30 bytes received, got %d with %d failed and %d bytes", merged.totalRequests, merged.totalFailedReqeusts, merged.totalReceived)
+	}
+	if merged.totalExecutionTime != 2*time.Second {
+		t.Fatalf("expected the longest execution time, got %s", merged.totalExecutionTime)
+	}
+	if merged.responseTimes.Min() != 10 || merged.responseTimes.Max() != 30 || merged.protocols["HTTP/1.1"] != 2 {
+		t.Fatalf("expected response times of 10ns to 30ns over HTTP/1.1, got %s to %s and %v", merged.responseTimes.Min(), merged.responseTimes.Max(), merged.protocols)
+	}
+	if merged.addresses["127.0.0.1"].totalRequests != 2 || merged.addresses["127.0.0.2"].totalFailedReqeusts != 1 {
+		t.Fatalf("expected the addresses to be merged, got %+v and %+v", merged.addresses["127.0.0.1"], merged.addresses["127.0.0.2"])
+	}
+	if merged.statusCodes["200"] != 2 {
+		t.Fatalf("expected 2 responses with status 200, got %v", merged.statusCodes)
+	}
+	if len(merged.timeline) != 2 || merged.timeline[0].totalRequests != 1 || merged.timeline[1].totalRequests != 2 || merged.timeline[1].totalFailedReqeusts != 1 {
+		t.Fatalf("expected a request in the first second and 2 in the next, got %+v and %+v", merged.timeline[0], merged.timeline[len(merged.timeline)-1])
+	}
+}
@@ -0,0 +1,715 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// field types and labels of google.protobuf.FieldDescriptorProto
+const (
+	protoDouble   = 1
+	protoFloat    = 2
+	protoInt64    = 3
+	protoUint64   = 4
+	protoInt32    = 5
+	protoFixed64  = 6
+	protoFixed32  = 7
+	protoBool     = 8
+	protoString   = 9
+	protoMessage  = 11
+	protoBytes    = 12
+	protoUint32   = 13
+	protoEnum     = 14
+	protoSfixed32 = 15
+	protoSfixed64 = 16
+	protoSint32   = 17
+	protoSint64   = 18
+
+	protoLabelRepeated = 3
+
+	protoMaxDurationSeconds = 315576000000 // 10000 years of google.protobuf.Duration
+)
+
+var (
+	ErrInvalidProtobuf = errors.New("invalid protobuf")
+)
+
+// ProtoDescriptors are the messages, enums and methods of a descriptor set,
+// eg. of 'protoc --include_imports --descriptor_set_out=api.protoset', by
+// full name without the leading dot
+type ProtoDescriptors struct {
+	messages map[string]*ProtoMessage
+	enums    map[string]*ProtoEnum
+	methods  map[string]*ProtoMethod // by 'package.Service/Method'
+}
+
+type ProtoMessage struct {
+	name     string
+	fields   []*ProtoField
+	mapEntry bool
+}
+
+type ProtoField struct {
+	name     string
+	jsonName string
+	number   int
+	kind     int
+	repeated bool
+	typeName string // of messages and enums
+}
+
+type ProtoEnum struct {
+	values map[string]int32
+}
+
+type ProtoMethod struct {
+	input     string
+	output    string
+	streaming bool
+}
+
+func LoadDescriptorSet(filename string) (*ProtoDescriptors, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDescriptorSet(data)
+}
+
+// ParseDescriptorSet reads a google.protobuf.FileDescriptorSet
+func ParseDescriptorSet(data []byte) (*ProtoDescriptors, error) {
+	d := &ProtoDescriptors{
+		messages: make(map[string]*ProtoMessage),
+		enums:    make(map[string]*ProtoEnum),
+		methods:  make(map[string]*ProtoMethod),
+	}
+
+	err := readProtoFields(data, func(number, wireType int, value uint64, bytes []byte) error {
+		if number == 1 && wireType == wireBytes {
+			return d.parseFile(bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *ProtoDescriptors) parseFile(data []byte) error {
+	var pkg string
+	var messages, enums, services [][]byte
+
+	err := readProtoFields(data, func(number, wireType int, value uint64, bytes []byte) error {
+		switch number {
+		case 2:
+			pkg = string(bytes)
+		case 4:
+			messages = append(messages, bytes)
+		case 5:
+			enums = append(enums, bytes)
+		case 6:
+			services = append(services, bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if err = d.parseMessage(pkg, message); err != nil {
+			return err
+		}
+	}
+	for _, enum := range enums {
+		if err = d.parseEnum(pkg, enum); err != nil {
+			return err
+		}
+	}
+	for _, service := range services {
+		if err = d.parseService(pkg, service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *ProtoDescriptors) parseMessage(scope string, data []byte) error {
+	message := &ProtoMessage{}
+	var nested, enums [][]byte
+
+	err := readProtoFields(data, func(number, wireType int, value uint64, bytes []byte) error {
+		switch number {
+		case 1:
+			message.name = qualify(scope, string(bytes))
+		case 2:
+			field, err := parseField(bytes)
+			if err != nil {
+				return err
+			}
+			message.fields = append(message.fields, field)
+		case 3:
+			nested = append(nested, bytes)
+		case 4:
+			enums = append(enums, bytes)
+		case 7:
+			// MessageOptions.map_entry
+			return readProtoFields(bytes, func(number, wireType int, value uint64, bytes []byte) error {
+				if number == 7 {
+					message.mapEntry = value != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.messages[message.name] = message
+	for _, data := range nested {
+		if err = d.parseMessage(message.name, data); err != nil {
+			return err
+		}
+	}
+	for _, data := range enums {
+		if err = d.parseEnum(message.name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseField(data []byte) (*ProtoField, error) {
+	field := &ProtoField{}
+	err := readProtoFields(data, func(number, wireType int, value uint64, bytes []byte) error {
+		switch number {
+		case 1:
+			field.name = string(bytes)
+		case 3:
+			field.number = int(value)
+		case 4:
+			field.repeated = value == protoLabelRepeated
+		case 5:
+			field.kind = int(value)
+		case 6:
+			field.typeName = strings.TrimPrefix(string(bytes), ".")
+		case 10:
+			field.jsonName = string(bytes)
+		}
+		return nil
+	})
+	return field, err
+}
+
+func (d *ProtoDescriptors) parseEnum(scope string, data []byte) error {
+	var name string
+	enum := &ProtoEnum{values: make(map[string]int32)}
+
+	err := readProtoFields(data, func(number, wireType int, value uint64, bytes []byte) error {
+		switch number {
+		case 1:
+			name = qualify(scope, string(bytes))
+		case 2:
+			var valueName string
+			var valueNumber int32
+			err := readProtoFields(bytes, func(number, wireType int, value uint64, bytes []byte) error {
+				switch number {
+				case 1:
+					valueName = string(bytes)
+				case 2:
+					valueNumber = int32(value)
+				}
+				return nil
+			})
+			enum.values[valueName] = valueNumber
+			return err
+		}
+		return nil
+	})
+
+	d.enums[name] = enum
+	return err
+}
+
+func (d *ProtoDescriptors) parseService(scope string, data []byte) error {
+	var name string
+	var methods [][]byte
+
+	err := readProtoFields(data, func(number, wireType int, value uint64, bytes []byte) error {
+		switch number {
+		case 1:
+			name = qualify(scope, string(bytes))
+		case 2:
+			methods = append(methods, bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, data := range methods {
+		var methodName string
+		method := &ProtoMethod{}
+		err = readProtoFields(data, func(number, wireType int, value uint64, bytes []byte) error {
+			switch number {
+			case 1:
+				methodName = string(bytes)
+			case 2:
+				method.input = strings.TrimPrefix(string(bytes), ".")
+			case 3:
+				method.output = strings.TrimPrefix(string(bytes), ".")
+			case 5, 6:
+				method.streaming = method.streaming || value != 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		d.methods[name+"/"+methodName] = method
+	}
+	return nil
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// readProtoFields calls fn with each field of a message, value is set for
+// varint and fixed fields and bytes for length delimited ones
+func readProtoFields(data []byte, fn func(number, wireType int, value uint64, bytes []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return ErrInvalidProtobuf
+		}
+		data = data[n:]
+
+		number, wireType := int(key>>3), int(key&7)
+		var value uint64
+		var bytes []byte
+
+		switch wireType {
+		case wireVarint:
+			if value, n = binary.Uvarint(data); n <= 0 {
+				return ErrInvalidProtobuf
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return ErrInvalidProtobuf
+			}
+			value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return ErrInvalidProtobuf
+			}
+			value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return ErrInvalidProtobuf
+			}
+			bytes, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", wireType)
+		}
+
+		if err := fn(number, wireType, value, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeJSON encodes a message given in the JSON mapping of protobuf,
+// fields are named by their json or proto name
+func (d *ProtoDescriptors) EncodeJSON(messageName string, data []byte) ([]byte, error) {
+	message, ok := d.messages[messageName]
+	if !ok {
+		return nil, fmt.Errorf("message %s not found in the descriptor set", messageName)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a json object", messageName)
+	}
+	return d.encodeMessage(nil, message, object)
+}
+
+func (d *ProtoDescriptors) encodeMessage(buf []byte, message *ProtoMessage, object map[string]interface{}) ([]byte, error) {
+	known := make(map[string]bool)
+
+	var err error
+	for _, field := range message.fields {
+		known[field.name], known[field.jsonName] = true, true
+
+		value, ok := object[field.jsonName]
+		if !ok {
+			value, ok = object[field.name]
+		}
+		if !ok || value == nil {
+			continue
+		}
+
+		if buf, err = d.encodeField(buf, field, value); err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", message.name, field.name, err)
+		}
+	}
+
+	for key := range object {
+		if !known[key] {
+			return nil, fmt.Errorf("%s has no field %s", message.name, key)
+		}
+	}
+	return buf, nil
+}
+
+func (d *ProtoDescriptors) encodeField(buf []byte, field *ProtoField, value interface{}) ([]byte, error) {
+	if !field.repeated {
+		return d.encodeValue(buf, field, value)
+	}
+
+	// maps are repeated entries of a key and a value field
+	if entry, ok := d.messages[field.typeName]; ok && entry.mapEntry && len(entry.fields) == 2 {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("expected a json object")
+		}
+		var err error
+		for key, value := range object {
+			var entryBuf []byte
+			if entryBuf, err = d.encodeValue(entryBuf, entry.fields[0], key); err != nil {
+				return nil, err
+			}
+			if value != nil {
+				if entryBuf, err = d.encodeValue(entryBuf, entry.fields[1], value); err != nil {
+					return nil, err
+				}
+			}
+			buf = appendProtoBytes(buf, field.number, entryBuf)
+		}
+		return buf, nil
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("expected a json array")
+	}
+	var err error
+	for _, value := range values {
+		if buf, err = d.encodeValue(buf, field, value); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func (d *ProtoDescriptors) encodeValue(buf []byte, field *ProtoField, value interface{}) ([]byte, error) {
+	switch field.kind {
+	case protoMessage:
+		if encoded, ok, err := encodeWellKnownType(field.typeName, value); ok {
+			if err != nil {
+				return nil, err
+			}
+			return appendProtoBytes(buf, field.number, encoded), nil
+		}
+		message, ok := d.messages[field.typeName]
+		if !ok {
+			return nil, fmt.Errorf("message %s not found in the descriptor set", field.typeName)
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("expected a json object")
+		}
+		encoded, err := d.encodeMessage(nil, message, object)
+		if err != nil {
+			return nil, err
+		}
+		return appendProtoBytes(buf, field.number, encoded), nil
+
+	case protoString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("expected a json string")
+		}
+		return appendProtoBytes(buf, field.number, []byte(s)), nil
+
+	case protoBytes:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("expected a base64 json string")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if decoded, err = base64.URLEncoding.DecodeString(s); err != nil {
+				return nil, err
+			}
+		}
+		return appendProtoBytes(buf, field.number, decoded), nil
+
+	case protoBool:
+		b, ok := value.(bool)
+		if !ok {
+			if b, ok = parseJSONBool(value); !ok {
+				return nil, errors.New("expected a json boolean")
+			}
+		}
+		var v uint64
+		if b {
+			v = 1
+		}
+		return appendProtoVarint(appendProtoTag(buf, field.number, wireVarint), v), nil
+
+	case protoEnum:
+		if name, ok := value.(string); ok {
+			enum, ok := d.enums[field.typeName]
+			if !ok {
+				return nil, fmt.Errorf("enum %s not found in the descriptor set", field.typeName)
+			}
+			number, ok := enum.values[name]
+			if !ok {
+				return nil, fmt.Errorf("enum %s has no value %s", field.typeName, name)
+			}
+			return appendProtoVarint(appendProtoTag(buf, field.number, wireVarint), uint64(int64(number))), nil
+		}
+		fallthrough
+
+	case protoInt32, protoInt64, protoUint32, protoUint64, protoSint32, protoSint64:
+		i, err := parseJSONInt(value, field.kind == protoUint32 || field.kind == protoUint64, protoBitSize(field.kind))
+		if err != nil {
+			return nil, err
+		}
+		if field.kind == protoSint32 || field.kind == protoSint64 {
+			i = uint64((int64(i) << 1) ^ (int64(i) >> 63))
+		}
+		return appendProtoVarint(appendProtoTag(buf, field.number, wireVarint), i), nil
+
+	case protoFixed32, protoSfixed32:
+		i, err := parseJSONInt(value, field.kind == protoFixed32, 32)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(appendProtoTag(buf, field.number, wireFixed32), uint32(i)), nil
+
+	case protoFixed64, protoSfixed64:
+		i, err := parseJSONInt(value, field.kind == protoFixed64, 64)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(appendProtoTag(buf, field.number, wireFixed64), i), nil
+
+	case protoFloat, protoDouble:
+		f, err := parseJSONFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		if field.kind == protoFloat {
+			if math.Abs(f) > math.MaxFloat32 && !math.IsInf(f, 0) {
+				return nil, fmt.Errorf("%s is out of the range of a float", value)
+			}
+			return binary.LittleEndian.AppendUint32(appendProtoTag(buf, field.number, wireFixed32), math.Float32bits(float32(f))), nil
+		}
+		return binary.LittleEndian.AppendUint64(appendProtoTag(buf, field.number, wireFixed64), math.Float64bits(f)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported field type %d", field.kind)
+}
+
+// protoBitSize is the size of the values of the integer field types
+func protoBitSize(kind int) int {
+	switch kind {
+	case protoInt32, protoUint32, protoSint32, protoEnum, protoFixed32, protoSfixed32:
+		return 32
+	}
+	return 64
+}
+
+// parseJSONInt takes numbers and strings, 64 bit integers are strings in
+// the JSON mapping of protobuf. Values out of the range of bitSize are errors
+// instead of being truncated
+func parseJSONInt(value interface{}, unsigned bool, bitSize int) (uint64, error) {
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	default:
+		return 0, errors.New("expected a json number")
+	}
+
+	if unsigned {
+		return strconv.ParseUint(s, 10, bitSize)
+	}
+	i, err := strconv.ParseInt(s, 10, bitSize)
+	return uint64(i), err
+}
+
+func parseJSONFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case string:
+		switch v {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, errors.New("expected a json number")
+}
+
+// parseJSONBool takes the string keys of maps
+func parseJSONBool(value interface{}) (bool, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return false, false
+	}
+	b, err := strconv.ParseBool(s)
+	return b, err == nil
+}
+
+// protoWrappers are the kinds of the value of the wrappers of
+// google/protobuf/wrappers.proto, which are their bare value in JSON
+var protoWrappers = map[string]int{
+	"google.protobuf.DoubleValue": protoDouble,
+	"google.protobuf.FloatValue":  protoFloat,
+	"google.protobuf.Int64Value":  protoInt64,
+	"google.protobuf.UInt64Value": protoUint64,
+	"google.protobuf.Int32Value":  protoInt32,
+	"google.protobuf.UInt32Value": protoUint32,
+	"google.protobuf.BoolValue":   protoBool,
+	"google.protobuf.StringValue": protoString,
+	"google.protobuf.BytesValue":  protoBytes,
+}
+
+// encodeWellKnownType encodes the well-known types with a JSON mapping of
+// their own, ok is false for other messages. Timestamps, durations and
+// wrappers are supported, the other well-known types are rejected
+func encodeWellKnownType(typeName string, value interface{}) (encoded []byte, ok bool, err error) {
+	if kind, ok := protoWrappers[typeName]; ok {
+		encoded, err = (&ProtoDescriptors{}).encodeValue(nil, &ProtoField{number: 1, kind: kind}, value)
+		return encoded, true, err
+	}
+
+	var seconds int64
+	var nanos int32
+	switch typeName {
+	case "google.protobuf.Timestamp":
+		s, ok := value.(string)
+		if !ok {
+			return nil, true, errors.New("expected an RFC 3339 json string")
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, true, err
+		}
+		if t.Year() < 1 {
+			return nil, true, fmt.Errorf("%s is before 0001-01-01", s)
+		}
+		seconds, nanos = t.Unix(), int32(t.Nanosecond())
+	case "google.protobuf.Duration":
+		s, ok := value.(string)
+		if !ok {
+			return nil, true, errors.New("expected a json string of seconds, eg. '1.5s'")
+		}
+		if seconds, nanos, err = parseProtoDuration(s); err != nil {
+			return nil, true, err
+		}
+	case "google.protobuf.Any", "google.protobuf.Struct", "google.protobuf.Value", "google.protobuf.ListValue", "google.protobuf.FieldMask":
+		return nil, true, fmt.Errorf("well-known type %s is not supported", typeName)
+	default:
+		return nil, false, nil
+	}
+
+	if seconds != 0 {
+		encoded = appendProtoVarint(appendProtoTag(encoded, 1, wireVarint), uint64(seconds))
+	}
+	if nanos != 0 {
+		encoded = appendProtoVarint(appendProtoTag(encoded, 2, wireVarint), uint64(int64(nanos)))
+	}
+	return encoded, true, nil
+}
+
+// parseProtoDuration parses the JSON mapping of durations, seconds with up
+// to 9 fractional digits and an 's' suffix, nanos have the sign of seconds
+func parseProtoDuration(s string) (seconds int64, nanos int32, err error) {
+	invalid := fmt.Errorf("invalid duration %q, expected seconds like '1.5s'", s)
+
+	if !strings.HasSuffix(s, "s") {
+		return 0, 0, invalid
+	}
+	digits := strings.TrimSuffix(s, "s")
+	negative := strings.HasPrefix(digits, "-")
+	whole, fraction, _ := strings.Cut(strings.TrimPrefix(digits, "-"), ".")
+	if len(fraction) > 9 {
+		return 0, 0, invalid
+	}
+
+	abs, err := strconv.ParseUint(whole, 10, 64)
+	if err != nil || abs > protoMaxDurationSeconds {
+		return 0, 0, invalid
+	}
+	seconds = int64(abs)
+	if fraction != "" {
+		n, err := strconv.ParseUint(fraction+strings.Repeat("0", 9-len(fraction)), 10, 32)
+		if err != nil {
+			return 0, 0, invalid
+		}
+		nanos = int32(n)
+	}
+
+	if negative {
+		seconds, nanos = -seconds, -nanos
+	}
+	return seconds, nanos, nil
+}
+
+func appendProtoTag(buf []byte, number int, wireType int) []byte {
+	return appendProtoVarint(buf, uint64(number)<<3|uint64(wireType))
+}
+
+func appendProtoVarint(buf []byte, v uint64) []byte {
+	return binary.AppendUvarint(buf, v)
+}
+
+func appendProtoBytes(buf []byte, number int, bytes []byte) []byte {
+	buf = appendProtoTag(buf, number, wireBytes)
+	buf = appendProtoVarint(buf, uint64(len(bytes)))
+	return append(buf, bytes...)
+}
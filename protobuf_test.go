@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// testDescriptorSet builds the descriptor set of
+//
+//	package test;
+//	enum Kind { KIND_A = 0; KIND_B = 1; }
+//	message Inner { string id = 1; }
+//	message HelloRequest {
+//	  string name = 1; int32 count = 2; repeated string tags = 3; Kind kind = 4;
+//	  Inner inner = 5; map<string, int64> scores = 6; sint32 delta = 7;
+//	  double ratio = 8; bool ok = 9; bytes blob = 10; string user_id = 11;
+//	  google.protobuf.Timestamp at = 12; google.protobuf.Duration took = 13;
+//	  google.protobuf.Int32Value limit = 14; google.protobuf.Any extra = 15;
+//	  uint32 size = 16; float weight = 17; fixed32 mask = 18;
+//	}
+//	message HelloReply { string message = 1; }
+//	service Greeter {
+//	  rpc SayHello(HelloRequest) returns (HelloReply);
+//	  rpc Chat(stream HelloRequest) returns (stream HelloReply);
+//	}
+func testDescriptorSet() []byte {
+	field := func(name string, number, kind int, repeated bool, typeName, jsonName string) []byte {
+		var b []byte
+		b = appendProtoBytes(b, 1, []byte(name))
+		b = appendProtoVarint(appendProtoTag(b, 3, wireVarint), uint64(number))
+		label := uint64(1)
+		if repeated {
+			label = protoLabelRepeated
+		}
+		b = appendProtoVarint(appendProtoTag(b, 4, wireVarint), label)
+		b = appendProtoVarint(appendProtoTag(b, 5, wireVarint), uint64(kind))
+		if typeName != "" {
+			b = appendProtoBytes(b, 6, []byte(typeName))
+		}
+		return appendProtoBytes(b, 10, []byte(jsonName))
+	}
+	message := func(name string, fields ...[]byte) []byte {
+		b := appendProtoBytes(nil, 1, []byte(name))
+		for _, f := range fields {
+			b = appendProtoBytes(b, 2, f)
+		}
+		return b
+	}
+
+	scoresEntry := message("ScoresEntry",
+		field("key", 1, protoString, false, "", "key"),
+		field("value", 2, protoInt64, false, "", "value"))
+	scoresEntry = appendProtoBytes(scoresEntry, 7, appendProtoVarint(appendProtoTag(nil, 7, wireVarint), 1))
+
+	request := message("HelloRequest",
+		field("name", 1, protoString, false, "", "name"),
+		field("count", 2, protoInt32, false, "", "count"),
+		field("tags", 3, protoString, true, "", "tags"),
+		field("kind", 4, protoEnum, false, ".test.Kind", "kind"),
+		field("inner", 5, protoMessage, false, ".test.Inner", "inner"),
+		field("scores", 6, protoMessage, true, ".test.HelloRequest.ScoresEntry", "scores"),
+		field("delta", 7, protoSint32, false, "", "delta"),
+		field("ratio", 8, protoDouble, false, "", "ratio"),
+		field("ok", 9, protoBool, false, "", "ok"),
+		field("blob", 10, protoBytes, false, "", "blob"),
+		field("user_id", 11, protoString, false, "", "userId"),
+		field("at", 12, protoMessage, false, ".google.protobuf.Timestamp", "at"),
+		field("took", 13, protoMessage, false, ".google.protobuf.Duration", "took"),
+		field("limit", 14, protoMessage, false, ".google.protobuf.Int32Value", "limit"),
+		field("extra", 15, protoMessage, false, ".google.protobuf.Any", "extra"),
+		field("size", 16, protoUint32, false, "", "size"),
+		field("weight", 17, protoFloat, false, "", "weight"),
+		field("mask", 18, protoFixed32, false, "", "mask"))
+	request = appendProtoBytes(request, 3, scoresEntry)
+
+	enumValue := func(name string, number int) []byte {
+		return appendProtoVarint(appendProtoTag(appendProtoBytes(nil, 1, []byte(name)), 2, wireVarint), uint64(number))
+	}
+	enum := appendProtoBytes(nil, 1, []byte("Kind"))
+	enum = appendProtoBytes(enum, 2, enumValue("KIND_A", 0))
+	enum = appendProtoBytes(enum, 2, enumValue("KIND_B", 1))
+
+	method := func(name string, streaming bool) []byte {
+		b := appendProtoBytes(nil, 1, []byte(name))
+		b = appendProtoBytes(b, 2, []byte(".test.HelloRequest"))
+		b = appendProtoBytes(b, 3, []byte(".test.HelloReply"))
+		if streaming {
+			b = appendProtoVarint(appendProtoTag(b, 5, wireVarint), 1)
+		}
+		return b
+	}
+	service := appendProtoBytes(nil, 1, []byte("Greeter"))
+	service = appendProtoBytes(service, 2, method("SayHello", false))
+	service = appendProtoBytes(service, 2, method("Chat", true))
+
+	file := appendProtoBytes(nil, 1, []byte("test.proto"))
+	file = appendProtoBytes(file, 2, []byte("test"))
+	file = appendProtoBytes(file, 4, message("Inner", field("id", 1, protoString, false, "", "id")))
+	file = appendProtoBytes(file, 4, request)
+	file = appendProtoBytes(file, 4, message("HelloReply", field("message", 1, protoString, false, "", "message")))
+	file = appendProtoBytes(file, 5, enum)
+	file = appendProtoBytes(file, 6, service)
+
+	return appendProtoBytes(nil, 1, file)
+}
+
+func TestParseDescriptorSet(t *testing.T) {
+	descriptors, err := ParseDescriptorSet(testDescriptorSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"test.Inner", "test.HelloRequest", "test.HelloRequest.ScoresEntry", "test.HelloReply"} {
+		if _, ok := descriptors.messages[name]; !ok {
+			t.Fatalf("expected message %s", name)
+		}
+	}
+	if !descriptors.messages["test.HelloRequest.ScoresEntry"].mapEntry {
+		t.Fatal("expected ScoresEntry to be a map entry")
+	}
+	if descriptors.enums["test.Kind"].values["KIND_B"] != 1 {
+		t.Fatal("expected enum value KIND_B = 1")
+	}
+
+	method, ok := descriptors.methods["test.Greeter/SayHello"]
+	if !ok || method.input != "test.HelloRequest" || method.output != "test.HelloReply" || method.streaming {
+		t.Fatalf("expected unary method test.Greeter/SayHello, got %+v", method)
+	}
+	if !descriptors.methods["test.Greeter/Chat"].streaming {
+		t.Fatal("expected test.Greeter/Chat to be streaming")
+	}
+
+	if _, err = ParseDescriptorSet([]byte{0x0a, 0x05, 0x01}); err == nil {
+		t.Fatal("expected an error for a truncated descriptor set")
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	descriptors, _ := ParseDescriptorSet(testDescriptorSet())
+
+	testData := []struct {
+		json     string
+		expected []byte
+	}{
+		{`{"name": "gb"}`, []byte{0x0a, 0x02, 'g', 'b'}},
+		{`{"count": -1}`, []byte{0x10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{`{"tags": ["a", "b"]}`, []byte{0x1a, 0x01, 'a', 0x1a, 0x01, 'b'}},
+		{`{"kind": "KIND_B"}`, []byte{0x20, 0x01}},
+		{`{"kind": 1}`, []byte{0x20, 0x01}},
+		{`{"inner": {"id": "x"}}`, []byte{0x2a, 0x03, 0x0a, 0x01, 'x'}},
+		{`{"scores": {"a": "7"}}`, []byte{0x32, 0x05, 0x0a, 0x01, 'a', 0x10, 0x07}},
+		{`{"delta": -2}`, []byte{0x38, 0x03}},
+		{`{"ratio": 1}`, []byte{0x41, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f}},
+		{`{"ok": true}`, []byte{0x48, 0x01}},
+		{`{"blob": "AQI="}`, []byte{0x52, 0x02, 0x01, 0x02}},
+		{`{"userId": "u"}`, []byte{0x5a, 0x01, 'u'}},
+		{`{"user_id": "u"}`, []byte{0x5a, 0x01, 'u'}},
+		{`{"name": null}`, nil},
+		{`{"at": "1970-01-01T00:00:01.5Z"}`, []byte{0x62, 0x08, 0x08, 0x01, 0x10, 0x80, 0xca, 0xb5, 0xee, 0x01}},
+		{`{"took": "-1.5s"}`, []byte{0x6a, 0x16, 0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x10, 0x80, 0xb6, 0xca, 0x91, 0xfe, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{`{"took": "0s"}`, []byte{0x6a, 0x00}},
+		{`{"limit": 5}`, []byte{0x72, 0x02, 0x08, 0x05}},
+		{`{"size": 4294967295}`, []byte{0x80, 0x01, 0xff, 0xff, 0xff, 0xff, 0x0f}},
+		{`{"mask": 1}`, []byte{0x95, 0x01, 0x01, 0, 0, 0}},
+	}
+
+	for _, data := range testData {
+		encoded, err := descriptors.EncodeJSON("test.HelloRequest", []byte(data.json))
+		if err != nil {
+			t.Fatalf("%s: %s", data.json, err)
+		}
+		if !bytes.Equal(encoded, data.expected) {
+			t.Fatalf("%s: expected % x, got % x", data.json, data.expected, encoded)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"missing": 1}`, `{"name": 1}`, `{"kind": "KIND_C"}`, `{"count": "x"}`, `[]`,
+		// values out of the range of the field are not truncated
+		`{"count": 2147483648}`, `{"count": -2147483649}`, `{"size": 4294967296}`, `{"size": -1}`,
+		`{"delta": 2147483648}`, `{"kind": 2147483648}`, `{"mask": 4294967296}`, `{"weight": 1e39}`, `{"limit": 2147483648}`,
+		// well-known types
+		`{"at": "yesterday"}`, `{"at": 1}`, `{"took": "1.5"}`, `{"took": "1.0000000001s"}`, `{"took": "315576000001s"}`,
+		`{"extra": {"@type": "type.googleapis.com/test.Inner", "id": "x"}}`,
+	} {
+		if _, err := descriptors.EncodeJSON("test.HelloRequest", []byte(invalid)); err == nil {
+			t.Fatalf("expected an error encoding %s", invalid)
+		}
+	}
+
+	// the encoding is read back by the wire format reader
+	encoded, _ := descriptors.EncodeJSON("test.HelloRequest", []byte(`{"name": "gb", "inner": {"id": "x"}, "count": 3}`))
+	fields := make(map[int]interface{})
+	readProtoFields(encoded, func(number, wireType int, value uint64, bytes []byte) error {
+		if wireType == wireBytes {
+			fields[number] = string(bytes)
+		} else {
+			fields[number] = value
+		}
+		return nil
+	})
+	if actual, _ := json.Marshal(fields); string(actual) != `{"1":"gb","2":3,"5":"\n\u0001x"}` {
+		t.Fatalf("unexpected fields %s", actual)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPushInterval = time.Duration(10) * time.Second
+)
+
+// Tag is a key and value, eg. a run-level tag of the aggregates pushed to
+// sinks like the url
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// ParseTag parses a 'key=value' tag
+func ParseTag(tag string) (Tag, error) {
+	pos := strings.Index(tag, "=")
+	if pos <= 0 {
+		return Tag{}, fmt.Errorf("invalid tag %q, expected 'key=value'", tag)
+	}
+	return Tag{tag[:pos], tag[pos+1:]}, nil
+}
+
+// setTag replaces the tag of the same key or adds it
+func setTag(tags []Tag, tag Tag) []Tag {
+	for i := range tags {
+		if tags[i].Key == tag.Key {
+			tags[i] = tag
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
+
+// Aggregate sums up the records of an interval
+type Aggregate struct {
+	start    time.Time
+	interval time.Duration
+
+	requests      int
+	failed        int
+	errors        map[string]int // failed requests by type, as in the metrics
+	received      int64
+	sent          int64
+	responseTimes Histogram // of successful requests
+
+	inflight int // at the end of the interval
+	workers  int
+}
+
+// Sink receives the aggregates of a running benchmark, it is closed when
+// the benchmark ends
+type Sink interface {
+	Push(aggregate *Aggregate) error
+	Close() error
+}
+
+// ParseSink returns the sink of a url: 'statsd://host:8125',
+// 'influx://host:8086/api/v2/write?org=o&bucket=b' or 'otlp://host:4318',
+// influxs and otlps for https
+func ParseSink(rawurl string, tags []Tag) (Sink, error) {
+	u, token, err := parseSinkURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := &url.URL{Scheme: "http", Host: u.Host, Path: u.Path, RawQuery: u.RawQuery}
+	switch u.Scheme {
+	case "statsd":
+		return NewStatsDSink(u.Host, tags)
+	case "influx", "influxs":
+		if u.Scheme == "influxs" {
+			endpoint.Scheme = "https"
+		}
+		if endpoint.Path == "" {
+			endpoint.Path = "/write"
+		}
+		return NewInfluxSink(endpoint.String(), token, tags), nil
+	case "otlp", "otlps":
+		if u.Scheme == "otlps" {
+			endpoint.Scheme = "https"
+		}
+		if endpoint.Path == "" {
+			endpoint.Path = "/v1/metrics"
+		}
+		return NewOTLPSink(endpoint.String(), token, tags), nil
+	}
+	return nil, fmt.Errorf("unsupported sink %q, must be statsd, influx or otlp", rawurl)
+}
+
+// parseSinkURL checks the url of a sink without connecting to it, the user
+// info of http sinks is returned as their token
+func parseSinkURL(rawurl string) (u *url.URL, token string, err error) {
+	if u, err = url.Parse(rawurl); err != nil {
+		return nil, "", err
+	}
+	if u.Host == "" {
+		return nil, "", fmt.Errorf("invalid sink %q, expected a host", rawurl)
+	}
+	switch u.Scheme {
+	case "statsd", "influx", "influxs", "otlp", "otlps":
+	default:
+		return nil, "", fmt.Errorf("unsupported sink %q, must be statsd, influx or otlp", rawurl)
+	}
+
+	if u.User != nil {
+		token = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			token = password
+		}
+	}
+	return u, token, nil
+}
+
+// Pusher aggregates the records of the monitor and pushes them to the sinks
+// of the config at every interval
+type Pusher struct {
+	c *Context
+
+	open  func(rawurl string, tags []Tag) (Sink, error) // ParseSink
+	sinks []Sink                                        // opened by Start, nil if they failed to
+
+	mu      sync.Mutex
+	current *Aggregate
+
+	failed map[int]bool // sinks which failed already, later errors are printed with -v only
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func NewPusher(context *Context) *Pusher {
+	return &Pusher{
+		c:      context,
+		open:   ParseSink,
+		failed: make(map[int]bool),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start opens the sinks and starts the first interval
+func (p *Pusher) Start() {
+	p.sinks = make([]Sink, len(p.c.config.pushURLs))
+	for i, rawurl := range p.c.config.pushURLs {
+		sink, err := p.open(rawurl, p.c.config.tags)
+		if err != nil {
+			fmt.Printf("Pushing to %s failed: %s\n", p.c.config.sinkURLs[i], err)
+			p.failed[i] = true
+			continue
+		}
+		p.sinks[i] = sink
+	}
+
+	p.current = newAggregate()
+	go p.loop()
+}
+
+// Stop pushes the last, usually shorter, interval and closes the sinks
+func (p *Pusher) Stop() {
+	close(p.stop)
+	<-p.done
+
+	for _, sink := range p.sinks {
+		if sink != nil {
+			sink.Close()
+		}
+	}
+}
+
+func (p *Pusher) Observe(record *Record) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	aggregate := p.current
+	aggregate.requests++
+	aggregate.received += record.contentSize
+	aggregate.sent += record.bodySent
+	if record.Error != nil {
+		aggregate.failed++
+		aggregate.errors[metricsErrorType(record.Error)]++
+	} else {
+		aggregate.responseTimes.Record(record.responseTime)
+	}
+}
+
+func (p *Pusher) loop() {
+	defer close(p.done)
+
+	t := time.NewTicker(p.c.config.pushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			p.push()
+		case <-p.stop:
+			p.push()
+			return
+		}
+	}
+}
+
+func (p *Pusher) push() {
+	p.mu.Lock()
+	aggregate := p.current
+	p.current = newAggregate()
+	p.mu.Unlock()
+
+	aggregate.interval = time.Since(aggregate.start)
+	aggregate.inflight = p.c.Inflight()
+	aggregate.workers = p.c.Workers()
+
+	for i, sink := range p.sinks {
+		if sink == nil {
+			continue
+		}
+		if err := sink.Push(aggregate); err != nil {
+			if !p.failed[i] || p.c.config.verbosity > 0 {
+				fmt.Printf("Pushing to %s failed: %s\n", p.c.config.sinkURLs[i], err)
+			}
+			p.failed[i] = true
+		}
+	}
+}
+
+func newAggregate() *Aggregate {
+	return &Aggregate{start: time.Now(), errors: make(map[string]int)}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSink struct {
+	mu         sync.Mutex
+	aggregates []*Aggregate
+	closed     bool
+}
+
+func (s *testSink) Push(aggregate *Aggregate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aggregates = append(s.aggregates, aggregate)
+	return nil
+}
+
+func (s *testSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// openTestSink makes the pusher of the context push to sink
+func openTestSink(context *Context, sink *testSink) {
+	context.pusher.open = func(rawurl string, tags []Tag) (Sink, error) {
+		return sink, nil
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	if tag, err := ParseTag("commit=4f2a=9c1"); err != nil || tag.Key != "commit" || tag.Value != "4f2a=9c1" {
+		t.Fatalf("expected commit and 4f2a=9c1, got %+v (%v)", tag, err)
+	}
+	for _, value := range []string{"commit", "=4f2a9c1"} {
+		if _, err := ParseTag(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+
+	tags := setTag([]Tag{{"url", "http://localhost/"}}, Tag{"url", "http://example.com/"})
+	if len(tags) != 1 || tags[0].Value != "http://example.com/" {
+		t.Fatalf("expected the tag to be replaced, got %+v", tags)
+	}
+}
+
+func TestParseSink(t *testing.T) {
+	testData := []struct {
+		url      string
+		endpoint string
+		token    string
+	}{
+		{"influx://localhost:8086", "http://localhost:8086/write", ""},
+		{"influxs://:secret@localhost:8086/api/v2/write?org=o&bucket=b", "https://localhost:8086/api/v2/write?org=o&bucket=b", "secret"},
+		{"otlp://localhost:4318", "http://localhost:4318/v1/metrics", ""},
+		{"otlps://secret@localhost:4318/otlp/v1/metrics", "https://localhost:4318/otlp/v1/metrics", "secret"},
+	}
+	for _, data := range testData {
+		sink, err := ParseSink(data.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch sink := sink.(type) {
+		case *InfluxSink:
+			if sink.endpoint != data.endpoint || sink.token != data.token {
+				t.Errorf("expected %s with %q for %s, got %s with %q", data.endpoint, data.token, data.url, sink.endpoint, sink.token)
+			}
+		case *OTLPSink:
+			if sink.endpoint != data.endpoint || sink.token != data.token {
+				t.Errorf("expected %s with %q for %s, got %s with %q", data.endpoint, data.token, data.url, sink.endpoint, sink.token)
+			}
+		}
+	}
+
+	if sink, err := ParseSink("statsd://127.0.0.1:8125", nil); err != nil {
+		t.Fatal(err)
+	} else if _, ok := sink.(*StatsDSink); !ok {
+		t.Fatalf("expected a statsd sink, got %T", sink)
+	}
+
+	for _, value := range []string{"graphite://localhost:2003", "statsd://"} {
+		if _, err := ParseSink(value, nil); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestMonitorWithPusher(t *testing.T) {
+	sink := &testSink{}
+	config := &Config{
+		requests:     3,
+		pushURLs:     []string{"test://"},
+		sinkURLs:     []string{"test://"},
+		pushInterval: time.Hour,
+	}
+
+	collector := make(chan *Record, config.requests)
+	collector <- &Record{responseTime: 10, contentSize: 5}
+	collector <- &Record{responseTime: 20, contentSize: 5}
+	collector <- &Record{Error: &ConnectError{errors.New("refused")}}
+	close(collector)
+
+	context := NewContext(config)
+	openTestSink(context, sink)
+
+	devnull, _ := os.Open(os.DevNull)
+	defer devnull.Close()
+	stdout := os.Stdout
+	os.Stdout = devnull
+
+	monitor := NewMonitor(context, collector)
+	go monitor.Run()
+	<-monitor.output
+
+	os.Stdout = stdout
+
+	// the last interval is pushed when the monitor stops
+	if len(sink.aggregates) != 1 {
+		t.Fatalf("expected an aggregate, got %d", len(sink.aggregates))
+	}
+	aggregate := sink.aggregates[0]
+	if aggregate.requests != 3 || aggregate.failed != 1 || aggregate.errors["connect"] != 1 || aggregate.received != 10 || aggregate.responseTimes.Count() != 2 {
+		t.Fatalf("expected 3 requests with 1 failed to connect, got %+v", aggregate)
+	}
+	if aggregate.interval <= 0 {
+		t.Fatalf("expected the interval to be measured, got %s", aggregate.interval)
+	}
+	if !sink.closed {
+		t.Fatal("expected the sink to be closed when the monitor stops")
+	}
+}
+
+func TestPusherInterval(t *testing.T) {
+	sink := &testSink{}
+	context := NewContext(&Config{pushURLs: []string{"test://"}, sinkURLs: []string{"test://"}, pushInterval: 10 * time.Millisecond})
+	openTestSink(context, sink)
+
+	context.pusher.Start()
+	context.pusher.Observe(&Record{responseTime: 10})
+	time.Sleep(35 * time.Millisecond)
+	context.pusher.Stop()
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.aggregates) < 3 {
+		t.Fatalf("expected an aggregate per interval, got %d", len(sink.aggregates))
+	}
+	requests := 0
+	for _, aggregate := range sink.aggregates {
+		requests += aggregate.requests
+	}
+	if requests != 1 {
+		t.Fatalf("expected the request to be pushed once, got %d", requests)
+	}
+}
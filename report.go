@@ -3,26 +3,33 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"math"
+	"io"
 	"net/url"
 	"sort"
+	"strings"
 	"time"
 )
 
 func PrintHeader() {
-	fmt.Println(`
+	fmt.Print(`
 This is GoHttpBench, Version ` + GBVersion + `, https://github.com/parkghost/gohttpbench
 Author: Brandon Chen, Email: parkghost@gmail.com
 Licensed under the MIT license
+
 `)
 }
 
 func PrintReport(context *Context, stats *Stats) {
+	fmt.Println(FormatReport(context, stats))
+}
+
+// FormatReport formats the results of a benchmark as text
+func FormatReport(context *Context, stats *Stats) string {
 
 	var buffer bytes.Buffer
 
 	config := context.config
-	responseTimeData := stats.responseTimeData
+	responseTimes := &stats.responseTimes
 	totalFailedReqeusts := stats.totalFailedReqeusts
 	totalRequests := stats.totalRequests
 	totalExecutionTime := stats.totalExecutionTime
@@ -31,43 +38,167 @@ func PrintReport(context *Context, stats *Stats) {
 	URL, _ := url.Parse(config.url)
 
 	fmt.Fprint(&buffer, "\n\n")
+	if stats.interrupted {
+		fmt.Fprint(&buffer, "WARNING: The benchmark was interrupted, the results below are partial\n\n")
+	}
 	fmt.Fprintf(&buffer, "Server Software:        %s\n", context.GetString(FieldServerName))
 	fmt.Fprintf(&buffer, "Server Hostname:        %s\n", config.host)
 	fmt.Fprintf(&buffer, "Server Port:            %d\n\n", config.port)
 
-	fmt.Fprintf(&buffer, "Document Path:          %s\n", URL.RequestURI())
-	fmt.Fprintf(&buffer, "Document Length:        %d bytes\n\n", context.GetInt(FieldContentSize))
+	if config.grpcMethod != "" {
+		fmt.Fprintf(&buffer, "gRPC Method:            %s\n", config.grpcMethod)
+	} else {
+		fmt.Fprintf(&buffer, "Document Path:          %s\n", URL.RequestURI())
+	}
+	if config.websocket {
+		fmt.Fprintf(&buffer, "Message Length:         %d bytes\n", context.GetInt(FieldContentSize))
+	} else {
+		fmt.Fprintf(&buffer, "Document Length:        %d bytes\n", context.GetInt(FieldContentSize))
+	}
+	if config.protocol == ProtocolHTTP2 || len(stats.protocols) > 1 {
+		var protocols []string
+		for protocol, count := range stats.protocols {
+			protocols = append(protocols, fmt.Sprintf("%s: %d", protocol, count))
+		}
+		sort.Strings(protocols)
+		fmt.Fprintf(&buffer, "Protocols:              %s\n", strings.Join(protocols, ", "))
+	}
+	fmt.Fprintln(&buffer)
 
 	fmt.Fprintf(&buffer, "Concurrency Level:      %d\n", config.concurrency)
+	if config.requests == 0 {
+		fmt.Fprintf(&buffer, "Time limit:             %d seconds\n", config.timelimit)
+	}
 	fmt.Fprintf(&buffer, "Time taken for tests:   %.2f seconds\n", totalExecutionTime.Seconds())
 	fmt.Fprintf(&buffer, "Complete requests:      %d\n", totalRequests)
+	if stats.interrupted {
+		fmt.Fprintf(&buffer, "Outstanding requests:   %d\n", stats.drainedRequests+stats.abortedRequests)
+		fmt.Fprintf(&buffer, "   (Drained: %d, Aborted: %d)\n", stats.drainedRequests, stats.abortedRequests)
+	}
+	if config.websocket {
+		fmt.Fprintf(&buffer, "WebSocket upgrades:     %d\n", stats.upgrades.Count())
+	}
+	if config.sse > 0 {
+		fmt.Fprintf(&buffer, "Total events:           %d\n", stats.totalEvents)
+	}
 	if totalFailedReqeusts == 0 {
 		fmt.Fprintln(&buffer, "Failed requests:        0")
 	} else {
 		fmt.Fprintf(&buffer, "Failed requests:        %d\n", totalFailedReqeusts)
 		fmt.Fprintf(&buffer, "   (Connect: %d, Receive: %d, Length: %d, Exceptions: %d)\n", stats.errConnect, stats.errReceive, stats.errLength, stats.errException)
+		if stats.errPorts > 0 {
+			fmt.Fprintf(&buffer, "   (Ephemeral ports exhausted: %d, consider -k or -B)\n", stats.errPorts)
+		}
+		if stats.errExtract > 0 {
+			fmt.Fprintf(&buffer, "   (Extractions failed: %d)\n", stats.errExtract)
+		}
 	}
-	if stats.errResponse > 0 {
+	if config.grpcMethod != "" {
+		if stats.errResponse > 0 {
+			fmt.Fprintf(&buffer, "Non-OK responses:       %d\n", stats.errResponse)
+		}
+		var statuses []string
+		for status, count := range stats.grpcStatuses {
+			statuses = append(statuses, fmt.Sprintf("%s: %d", status, count))
+		}
+		sort.Strings(statuses)
+		fmt.Fprintf(&buffer, "gRPC statuses:          %s\n", strings.Join(statuses, ", "))
+	} else if stats.errResponse > 0 {
 		fmt.Fprintf(&buffer, "Non-2xx responses:      %d\n", stats.errResponse)
 	}
+	if stats.totalTransferred > 0 {
+		fmt.Fprintf(&buffer, "Total transferred:      %d bytes\n", stats.totalTransferred)
+		fmt.Fprintf(&buffer, "Total sent:             %d bytes\n", stats.totalWireSent)
+	}
+	if stats.totalSent > 0 {
+		fmt.Fprintf(&buffer, "Total body sent:        %d bytes\n", stats.totalSent)
+	}
 	fmt.Fprintf(&buffer, "HTML transferred:       %d bytes\n", totalReceived)
+	if len(stats.encodings) > 0 {
+		fmt.Fprintf(&buffer, "HTML decoded:           %d bytes\n", stats.totalDecoded)
+
+		var encodings []string
+		decoded := 0
+		for encoding, count := range stats.encodings {
+			if _, ok := contentDecoders[encoding]; ok {
+				encodings = append(encodings, fmt.Sprintf("%s: %d", encoding, count))
+				decoded += count
+			} else {
+				encodings = append(encodings, fmt.Sprintf("%s: %d (not decoded)", encoding, count))
+			}
+		}
+		sort.Strings(encodings)
+		fmt.Fprintf(&buffer, "Content encodings:      %s\n", strings.Join(encodings, ", "))
+
+		if decoded > 0 {
+			fmt.Fprintf(&buffer, "Decoding time:          %.3f [ms] (mean, per decoded response)\n", float64(stats.totalDecodeTime.Nanoseconds())/1000000/float64(decoded))
+		}
+	}
+
+	if config.tlsResume {
+		fmt.Fprintf(&buffer, "TLS sessions resumed:   %d of %d handshakes\n", stats.tlsResumed, stats.tlsHandshakes.Count())
+	}
+	if stats.tcpInfo != nil && stats.tcpInfo.rtt.Count() > 0 {
+		tcpInfo := stats.tcpInfo
+		connections := tcpInfo.rtt.Count()
 
-	if len(responseTimeData) > 0 && totalExecutionTime > 0 {
-		stdDevOfResponseTime := stdDev(responseTimeData) / 1000000
-		sort.Sort(durationSlice(responseTimeData))
+		fmt.Fprintf(&buffer, "TCP connections:        %d (closed)\n", connections)
+		fmt.Fprintf(&buffer, "TCP RTT:                %.3f [ms] (mean), %.3f [ms] (median), %.3f [ms] (max), %.3f [ms] (mean rttvar)\n",
+			float64(tcpInfo.rtt.Sum())/float64(connections)/1000000,
+			float64(tcpInfo.rtt.Percentile(50))/1000000,
+			float64(tcpInfo.rtt.Max())/1000000,
+			float64(tcpInfo.sumOfRTTVar)/float64(connections)/1000000)
+		fmt.Fprintf(&buffer, "TCP retransmits:        %d segments\n", tcpInfo.retransmits)
+		fmt.Fprintf(&buffer, "TCP cwnd:               %d (min), %.1f (mean) segments\n", tcpInfo.minCwnd, float64(tcpInfo.sumOfCwnd)/float64(connections))
+	}
+
+	if responseTimes.Count() > 0 && totalExecutionTime > 0 {
+		stdDevOfResponseTime := responseTimes.StdDev() / 1000000
 
 		meanOfResponseTime := int64(totalExecutionTime) / int64(totalRequests) / 1000000
-		medianOfResponseTime := responseTimeData[len(responseTimeData)/2] / 1000000
-		minResponseTime := responseTimeData[0] / 1000000
-		maxResponseTime := responseTimeData[len(responseTimeData)-1] / 1000000
+		medianOfResponseTime := responseTimes.Percentile(50) / 1000000
+		minResponseTime := responseTimes.Min() / 1000000
+		maxResponseTime := responseTimes.Max() / 1000000
 
-		fmt.Fprintf(&buffer, "Requests per second:    %.2f [#/sec] (mean)\n", float64(totalRequests)/totalExecutionTime.Seconds())
+		if config.websocket {
+			fmt.Fprintf(&buffer, "Messages per second:    %.2f [#/sec] (mean, round trips)\n", float64(totalRequests)/totalExecutionTime.Seconds())
+		} else {
+			fmt.Fprintf(&buffer, "Requests per second:    %.2f [#/sec] (mean)\n", float64(totalRequests)/totalExecutionTime.Seconds())
+		}
+		if config.sse > 0 {
+			fmt.Fprintf(&buffer, "Events per second:      %.2f [#/sec] (mean, across all connections)\n", float64(stats.totalEvents)/totalExecutionTime.Seconds())
+			fmt.Fprintf(&buffer, "Connection lifetime:    %.3f [ms] (mean)\n", float64(stats.totalResponseTime.Nanoseconds())/1000000/float64(responseTimes.Count()))
+		}
 		fmt.Fprintf(&buffer, "Time per request:       %.3f [ms] (mean)\n", float64(config.concurrency)*float64(totalExecutionTime.Nanoseconds())/1000000/float64(totalRequests))
 		fmt.Fprintf(&buffer, "Time per request:       %.3f [ms] (mean, across all concurrent requests)\n", float64(totalExecutionTime.Nanoseconds())/1000000/float64(totalRequests))
-		fmt.Fprintf(&buffer, "HTML Transfer rate:     %.2f [Kbytes/sec] received\n\n", float64(totalReceived/1024)/totalExecutionTime.Seconds())
+		fmt.Fprintf(&buffer, "HTML Transfer rate:     %.2f [Kbytes/sec] received\n", float64(totalReceived/1024)/totalExecutionTime.Seconds())
+		if stats.totalSent > 0 {
+			fmt.Fprintf(&buffer, "Transfer rate sent:     %.2f [Kbytes/sec] sent\n", float64(stats.totalSent)/1024/totalExecutionTime.Seconds())
+		}
+		if stats.totalTransferred > 0 {
+			fmt.Fprintf(&buffer, "Network throughput:     %.2f [Kbytes/sec] received\n", float64(stats.totalTransferred)/1024/totalExecutionTime.Seconds())
+			fmt.Fprintf(&buffer, "                        %.2f [Kbytes/sec] sent\n", float64(stats.totalWireSent)/1024/totalExecutionTime.Seconds())
+			fmt.Fprintf(&buffer, "                        %.2f [Kbytes/sec] total\n", float64(stats.totalTransferred+stats.totalWireSent)/1024/totalExecutionTime.Seconds())
+		}
+		fmt.Fprintln(&buffer)
 
 		fmt.Fprint(&buffer, "Connection Times (ms)\n")
 		fmt.Fprint(&buffer, "              min\tmean[+/-sd]\tmedian\tmax\n")
+		if stats.proxyConnects.Count() > 0 {
+			fprintConnectionTimes(&buffer, "Proxy:", &stats.proxyConnects)
+		}
+		if stats.tlsHandshakes.Count() > 0 {
+			fprintConnectionTimes(&buffer, "TLS:", &stats.tlsHandshakes)
+		}
+		if stats.upgrades.Count() > 0 {
+			fprintConnectionTimes(&buffer, "Upgrade:", &stats.upgrades)
+		}
+		if stats.firstEvents.Count() > 0 {
+			fprintConnectionTimes(&buffer, "First event:", &stats.firstEvents)
+		}
+		if stats.eventGaps.Count() > 0 {
+			fprintConnectionTimes(&buffer, "Event gap:", &stats.eventGaps)
+		}
 		fmt.Fprintf(&buffer, "Total:        %d     \t%d   %.2f \t%d \t%d\n\n",
 			minResponseTime,
 			meanOfResponseTime,
@@ -80,32 +211,73 @@ func PrintReport(context *Context, stats *Stats) {
 		percentages := []int{50, 66, 75, 80, 90, 95, 98, 99}
 
 		for _, percentage := range percentages {
-			fmt.Fprintf(&buffer, " %d%%\t %d\n", percentage, responseTimeData[percentage*len(responseTimeData)/100]/1000000)
+			fmt.Fprintf(&buffer, " %d%%\t %d\n", percentage, responseTimes.Percentile(float64(percentage))/1000000)
 		}
 		fmt.Fprintf(&buffer, " %d%%\t %d (longest request)\n", 100, maxResponseTime)
 	}
-	fmt.Println(buffer.String())
-}
 
-type durationSlice []time.Duration
+	if len(stats.steps) > 0 {
+		fmt.Fprint(&buffer, "\nScenario steps (ms)\n")
+		fmt.Fprintf(&buffer, "  %-20s %8s %8s %8s %8s %8s %8s %8s\n", "", "requests", "failed", "min", "mean", "median", "95%", "max")
+		for _, step := range stats.steps {
+			fmt.Fprintf(&buffer, "  %-20s %8d %8d %s\n", step.name, step.totalRequests, step.totalFailedReqeusts, summarize(&step.responseTimes))
+		}
+		fmt.Fprintf(&buffer, "  %-20s %8d %8d %s\n", "(transaction)", totalRequests, totalFailedReqeusts, summarize(responseTimes))
+	}
+
+	// addresses are listed when requests were spread or sent elsewhere than
+	// the system resolver would
+	if len(stats.addresses) > 1 || (len(stats.addresses) > 0 && config.resolver != nil) {
+		var addresses []string
+		for address := range stats.addresses {
+			addresses = append(addresses, address)
+		}
+		sort.Strings(addresses)
 
-func (s durationSlice) Len() int           { return len(s) }
-func (s durationSlice) Less(i, j int) bool { return s[i] < s[j] }
-func (s durationSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+		fmt.Fprint(&buffer, "\nAddresses (ms)\n")
+		fmt.Fprintf(&buffer, "  %-20s %8s %8s %8s %8s %8s %8s %8s\n", "", "requests", "failed", "min", "mean", "median", "95%", "max")
+		for _, address := range addresses {
+			addressStats := stats.addresses[address]
+			fmt.Fprintf(&buffer, "  %-20s %8d %8d %s\n", address, addressStats.totalRequests, addressStats.totalFailedReqeusts, summarize(&addressStats.responseTimes))
+		}
+	}
 
-// StdDev calculate standard deviation
-func stdDev(data []time.Duration) float64 {
-	var sum int64
-	for _, d := range data {
-		sum += int64(d)
+	if len(stats.agents) > 0 {
+		fmt.Fprint(&buffer, "\nAgents (ms)\n")
+		fmt.Fprintf(&buffer, "  %-20s %8s %8s %8s %8s %8s %8s %8s %8s\n", "", "requests", "failed", "#/sec", "min", "mean", "median", "95%", "max")
+		for _, agent := range stats.agents {
+			var requestsPerSecond float64
+			if agent.totalExecutionTime > 0 {
+				requestsPerSecond = float64(agent.totalRequests) / agent.totalExecutionTime.Seconds()
+			}
+			fmt.Fprintf(&buffer, "  %-20s %8d %8d %8.1f %s\n", agent.name, agent.totalRequests, agent.totalFailedReqeusts, requestsPerSecond, summarize(&agent.responseTimes))
+		}
 	}
-	avg := float64(sum / int64(len(data)))
+	return buffer.String()
+}
 
-	sumOfSquares := 0.0
-	for _, d := range data {
+// fprintConnectionTimes prints a row of the connection times table
+func fprintConnectionTimes(w io.Writer, name string, data *Histogram) {
+	fmt.Fprintf(w, "%-14s%d     \t%d   %.2f \t%d \t%d\n",
+		name,
+		data.Min()/1000000,
+		data.Mean()/1000000,
+		data.StdDev()/1000000,
+		data.Percentile(50)/1000000,
+		data.Max()/1000000)
+}
 
-		sumOfSquares += math.Pow(float64(d)-avg, 2)
+// summarize formats min, mean, median, 95th percentile and max of response
+// times in milliseconds
+func summarize(data *Histogram) string {
+	if data.Count() == 0 {
+		return fmt.Sprintf("%8s %8s %8s %8s %8s", "-", "-", "-", "-", "-")
 	}
-	return math.Sqrt(sumOfSquares / float64(len(data)))
 
+	return fmt.Sprintf("%8d %8d %8d %8d %8d",
+		data.Min()/time.Millisecond,
+		data.Mean()/time.Millisecond,
+		data.Percentile(50)/time.Millisecond,
+		data.Percentile(95)/time.Millisecond,
+		data.Max()/time.Millisecond)
 }
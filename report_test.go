@@ -12,7 +12,11 @@ func TestStdDev(t *testing.T) {
 	}
 
 	for expectedData, testingData := range testData {
-		if result := stdDev(testingData); int(result*1000) != int(expectedData*1000) {
+		histogram := &Histogram{}
+		for _, d := range testingData {
+			histogram.Record(d)
+		}
+		if result := histogram.StdDev(); int(result*1000) != int(expectedData*1000) {
 			t.Errorf("expected %f, got %f", expectedData, result)
 		}
 	}
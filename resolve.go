@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Resolver picks the address connections to 'host:port' are dialed to,
+// overrides are given like curl --resolve 'host:port:addr[,addr]'. Hosts
+// resolved for round-robin are looked up once per benchmark
+type Resolver struct {
+	roundRobin bool
+	lookup     func(ctx context.Context, host string) ([]string, error)
+
+	mu    sync.Mutex
+	hosts map[string]*resolvedHost // by 'host:port'
+}
+
+type resolvedHost struct {
+	addrs []string // 'ip:port'
+	next  uint32
+}
+
+func NewResolver(overrides []string, roundRobin bool) (*Resolver, error) {
+	r := &Resolver{
+		roundRobin: roundRobin,
+		lookup:     net.DefaultResolver.LookupHost,
+		hosts:      make(map[string]*resolvedHost),
+	}
+
+	for _, override := range overrides {
+		hostport, addrs, err := ParseResolve(override)
+		if err != nil {
+			return nil, err
+		}
+		r.hosts[hostport] = &resolvedHost{addrs: addrs}
+	}
+	return r, nil
+}
+
+// ParseResolve splits 'host:port:addr[,addr]' into 'host:port' and the
+// 'addr:port' to connect to, IPv6 addresses are given in brackets
+func ParseResolve(override string) (hostport string, addrs []string, err error) {
+	invalid := fmt.Errorf("invalid resolve %q, expected 'host:port:addr[,addr]'", override)
+
+	parts := strings.SplitN(override, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", nil, invalid
+	}
+	host, port := parts[0], parts[1]
+
+	for _, addr := range strings.Split(parts[2], ",") {
+		addr = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(addr), "["), "]")
+		if net.ParseIP(addr) == nil {
+			return "", nil, invalid
+		}
+		addrs = append(addrs, net.JoinHostPort(addr, port))
+	}
+	return net.JoinHostPort(host, port), addrs, nil
+}
+
+// Resolve returns the address to dial instead of addr, addr itself when it
+// is neither overridden nor resolved round-robin
+func (r *Resolver) Resolve(ctx context.Context, addr string) (string, error) {
+	r.mu.Lock()
+	resolved, ok := r.hosts[addr]
+	r.mu.Unlock()
+
+	if !ok {
+		if !r.roundRobin {
+			return addr, nil
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return "", err
+		}
+		if net.ParseIP(host) != nil {
+			return addr, nil
+		}
+
+		ips, err := r.lookup(ctx, host)
+		if err != nil {
+			return "", err
+		}
+
+		resolved = &resolvedHost{}
+		for _, ip := range ips {
+			resolved.addrs = append(resolved.addrs, net.JoinHostPort(ip, port))
+		}
+
+		// concurrent lookups of a host keep the first result
+		r.mu.Lock()
+		if existing, ok := r.hosts[addr]; ok {
+			resolved = existing
+		} else {
+			r.hosts[addr] = resolved
+		}
+		r.mu.Unlock()
+	}
+
+	if len(resolved.addrs) == 0 {
+		return "", fmt.Errorf("no addresses for %s", addr)
+	}
+
+	next := atomic.AddUint32(&resolved.next, 1) - 1
+	return resolved.addrs[next%uint32(len(resolved.addrs))], nil
+}
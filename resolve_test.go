@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseResolve(t *testing.T) {
+	testData := []struct {
+		override string
+		hostport string
+		addrs    []string
+		valid    bool
+	}{
+		{"example.com:443:10.0.0.1", "example.com:443", []string{"10.0.0.1:443"}, true},
+		{"example.com:80:10.0.0.1,10.0.0.2", "example.com:80", []string{"10.0.0.1:80", "10.0.0.2:80"}, true},
+		{"example.com:443:[::1]", "example.com:443", []string{"[::1]:443"}, true},
+		{"example.com:443", "", nil, false},
+		{"example.com:443:backend", "", nil, false},
+		{":443:10.0.0.1", "", nil, false},
+	}
+
+	for _, data := range testData {
+		hostport, addrs, err := ParseResolve(data.override)
+		if (err == nil) != data.valid {
+			t.Fatalf("expected %s valid to be %t, got error %v", data.override, data.valid, err)
+		}
+		if hostport != data.hostport || !reflect.DeepEqual(addrs, data.addrs) {
+			t.Fatalf("expected %s %v, got %s %v", data.hostport, data.addrs, hostport, addrs)
+		}
+	}
+}
+
+func TestResolverRoundRobin(t *testing.T) {
+	resolver, err := NewResolver([]string{"override.test:80:10.0.0.1,10.0.0.2"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lookups := 0
+	resolver.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		return []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}, nil
+	}
+
+	testData := []struct {
+		addr     string
+		expected []string
+	}{
+		{"override.test:80", []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.1:80"}},
+		{"lookup.test:443", []string{"192.0.2.1:443", "192.0.2.2:443", "192.0.2.3:443", "192.0.2.1:443"}},
+		{"127.0.0.1:8080", []string{"127.0.0.1:8080"}},
+	}
+
+	for _, data := range testData {
+		for _, expected := range data.expected {
+			addr, err := resolver.Resolve(context.Background(), data.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr != expected {
+				t.Fatalf("expected %s to resolve to %s, got %s", data.addr, expected, addr)
+			}
+		}
+	}
+
+	if lookups != 1 {
+		t.Fatalf("expected a host to be looked up once, got %d lookups", lookups)
+	}
+}
+
+func TestHTTPWithResolve(t *testing.T) {
+	responseStr := "hello"
+
+	var hosts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		w.Write([]byte(responseStr))
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	_, port, _ := net.SplitHostPort(tsURL.Host)
+
+	resolver, err := NewResolver([]string{"backend.test:" + port + ":127.0.0.1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		concurrency:      1,
+		requests:         2,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              "http://backend.test:" + port + "/",
+		resolver:         resolver,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, len(responseStr))
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	for record := range benchmark.collector {
+		if record.Error != nil {
+			t.Fatalf("sent a http reqeust but was error: %s", record.Error)
+		}
+		if record.remoteIP != "127.0.0.1" {
+			t.Fatalf("expected the request to be sent to 127.0.0.1, got %q", record.remoteIP)
+		}
+	}
+	context.abort()
+
+	for _, host := range hosts {
+		if host != "backend.test:"+port {
+			t.Fatalf("expected the Host header of the url to be kept, got %s", host)
+		}
+	}
+}
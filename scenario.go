@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrEmptyScenario = errors.New("scenario has no steps")
+)
+
+// Scenario is a flow of steps a virtual user goes through per job, eg.
+//
+//	{"steps": [
+//	  {"name": "login", "method": "POST", "url": "/login", "body": "user={{.Data.user}}",
+//	   "headers": ["Content-Type: application/x-www-form-urlencoded"],
+//	   "extract": {"token": {"json": "auth.token"}}},
+//	  {"name": "profile", "url": "/me", "headers": ["Authorization: Bearer {{.Vars.token}}"]}
+//	]}
+type Scenario struct {
+	Steps []*Step `json:"steps"`
+}
+
+type Step struct {
+	Name    string                `json:"name"`
+	Method  string                `json:"method"`
+	URL     string                `json:"url"` // relative urls are resolved against the benchmarked url
+	Headers []string              `json:"headers"`
+	Cookies []string              `json:"cookies"`
+	Body    string                `json:"body"`
+	Extract map[string]*Extractor `json:"extract"`
+
+	template *RequestTemplate
+}
+
+// Extractor takes a variable from the response of a step, it is available
+// to the following steps as '{{.Vars.name}}'
+type Extractor struct {
+	JSON   string `json:"json"`   // dot separated path into a json body, eg. 'items.0.id'
+	Header string `json:"header"` // response header
+	Cookie string `json:"cookie"` // cookie set by the response
+	Regexp string `json:"regexp"` // first submatch of a regular expression on the body
+
+	regexp *regexp.Regexp
+}
+
+func LoadScenario(filename string, config *Config) (scenario *Scenario, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scenario = &Scenario{}
+	if err = json.NewDecoder(file).Decode(scenario); err != nil {
+		return
+	}
+
+	if len(scenario.Steps) == 0 {
+		err = ErrEmptyScenario
+		return
+	}
+
+	base, err := url.Parse(config.url)
+	if err != nil {
+		return
+	}
+
+	for i, step := range scenario.Steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+
+		stepConfig := *config
+		stepConfig.method = step.Method
+		if stepConfig.method == "" {
+			stepConfig.method = "GET"
+		} else if !isToken(stepConfig.method) {
+			err = fmt.Errorf("%s: invalid method %q", step.Name, step.Method)
+			return
+		}
+		stepConfig.url = step.URL
+		if strings.HasPrefix(step.URL, "/") {
+			stepConfig.url = base.Scheme + "://" + base.Host + step.URL
+		}
+		// headers and cookies of steps are checked up front like those of
+		// the command line
+		for _, header := range step.Headers {
+			if _, _, err = ParseHeader(header); err != nil {
+				err = fmt.Errorf("%s: %s", step.Name, err)
+				return
+			}
+		}
+		for _, cookie := range step.Cookies {
+			if _, _, err = ParseCookie(cookie); err != nil {
+				err = fmt.Errorf("%s: %s", step.Name, err)
+				return
+			}
+		}
+
+		stepConfig.headers = append(append([]string(nil), config.headers...), step.Headers...)
+		stepConfig.cookies = append(append([]string(nil), config.cookies...), step.Cookies...)
+		stepConfig.bodyContent = nil
+		stepConfig.bodyFile = ""
+		stepConfig.form = nil
+		if step.Body != "" {
+			stepConfig.bodyContent = []byte(step.Body)
+		}
+
+		if step.template, err = NewRequestTemplate(&stepConfig); err != nil {
+			err = fmt.Errorf("%s: %s", step.Name, err)
+			return
+		}
+
+		for name, extractor := range step.Extract {
+			if extractor.Regexp != "" {
+				if extractor.regexp, err = regexp.Compile(extractor.Regexp); err != nil {
+					err = fmt.Errorf("%s: %s: %s", step.Name, name, err)
+					return
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// extract stores the variables of the step taken from the response into vars
+func (s *Step) extract(resp *http.Response, body []byte, vars map[string]string) error {
+	for name, extractor := range s.Extract {
+		value, err := extractor.extract(resp, body)
+		if err != nil {
+			return fmt.Errorf("%s: extract %s: %s", s.Name, name, err)
+		}
+		vars[name] = value
+	}
+	return nil
+}
+
+func (e *Extractor) extract(resp *http.Response, body []byte) (string, error) {
+	switch {
+	case e.JSON != "":
+		var value interface{}
+		decoder := json.NewDecoder(strings.NewReader(string(body)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return "", err
+		}
+		return lookupJSON(value, e.JSON)
+
+	case e.Header != "":
+		if value := resp.Header.Get(e.Header); value != "" {
+			return value, nil
+		}
+		return "", fmt.Errorf("header %s not found", e.Header)
+
+	case e.Cookie != "":
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == e.Cookie {
+				return cookie.Value, nil
+			}
+		}
+		return "", fmt.Errorf("cookie %s not found", e.Cookie)
+
+	case e.regexp != nil:
+		if match := e.regexp.FindSubmatch(body); len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return "", fmt.Errorf("regexp %s not matched", e.Regexp)
+	}
+
+	return "", errors.New("no extractor given")
+}
+
+func lookupJSON(value interface{}, path string) (string, error) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return "", fmt.Errorf("json path %s not found", path)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("json path %s not found", path)
+			}
+			value = v[i]
+		default:
+			return "", fmt.Errorf("json path %s not found", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded), nil
+	}
+}
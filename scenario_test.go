@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newScenarioServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			user := r.FormValue("user")
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s-" + user})
+			fmt.Fprintf(w, `{"auth": {"token": "t-%s"}}`, user)
+		case "/me":
+			cookie, err := r.Cookie("session")
+			if err != nil || cookie.Value != r.FormValue("session") || r.Header.Get("Authorization") != "Bearer t-"+cookie.Value[2:] {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("hello"))
+		}
+	}))
+}
+
+func TestLoadScenario(t *testing.T) {
+	config := &Config{url: "http://localhost:8080/"}
+
+	scenario, err := LoadScenario("testdata/scenario.json", config)
+	if err != nil {
+		t.Fatalf("load scenario failed: %s", err)
+	}
+
+	if len(scenario.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(scenario.Steps))
+	}
+
+	if step := scenario.Steps[1]; step.template.config.url != "http://localhost:8080/me?session={{.Vars.session}}" || step.template.config.method != "GET" {
+		t.Fatalf("expected relative url to be resolved with default method, got %s %s", step.template.config.method, step.template.config.url)
+	}
+}
+
+func TestLoadScenarioWithInvalidHeader(t *testing.T) {
+	file, err := ioutil.TempFile("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"steps": [{"name": "login", "url": "/login", "headers": ["Bearer {{.Vars.token}}"]}]}`)
+	file.Close()
+
+	if _, err = LoadScenario(file.Name(), &Config{url: "http://localhost:8080/"}); err == nil || !strings.HasPrefix(err.Error(), "login: invalid header") {
+		t.Fatalf("expected the invalid header of the step, got %v", err)
+	}
+}
+
+func TestLookupJSON(t *testing.T) {
+	var value interface{} = map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"id": "a"}, map[string]interface{}{"id": "b"}},
+		"count": 2.0,
+	}
+
+	testData := map[string]string{
+		"items.1.id": "b",
+		"count":      "2",
+	}
+
+	for path, expected := range testData {
+		if actual, err := lookupJSON(value, path); err != nil || actual != expected {
+			t.Errorf("expected %s for %s, got %s (%v)", expected, path, actual, err)
+		}
+	}
+
+	if _, err := lookupJSON(value, "items.2.id"); err == nil {
+		t.Error("expected error for missing path")
+	}
+}
+
+func TestBenchmarkWithScenario(t *testing.T) {
+	ts := newScenarioServer()
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      2,
+		requests:         6,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+	config.feeder, _ = NewFeeder("testdata/data.csv", nil, FeedSequential)
+
+	var err error
+	if config.scenario, err = LoadScenario("testdata/scenario.json", config); err != nil {
+		t.Fatalf("load scenario failed: %s", err)
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	stats := &Stats{steps: []*StepStats{&StepStats{name: "login"}, &StepStats{name: "profile"}}}
+	for record := range benchmark.collector {
+		if record.Error != nil {
+			t.Fatalf("expected scenario to pass, but was error: %s", record.Error)
+		}
+		updateStats(stats, record)
+	}
+	context.abort()
+
+	if stats.totalRequests != 6 || stats.steps[0].totalRequests != 6 || stats.steps[1].totalRequests != 6 {
+		t.Fatalf("expected 6 transactions of 2 steps, got %d, %d and %d", stats.totalRequests, stats.steps[0].totalRequests, stats.steps[1].totalRequests)
+	}
+}
+
+func TestScenarioTransactionTime(t *testing.T) {
+	ts := newScenarioServer()
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         1,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+	config.feeder, _ = NewFeeder("testdata/data.csv", nil, FeedSequential)
+	config.scenario, _ = LoadScenario("testdata/scenario.json", config)
+	config.thinkTime, _ = ParseThinkTime("50ms")
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+	record := <-benchmark.collector
+	context.abort()
+
+	if record.Error != nil {
+		t.Fatalf("expected scenario to pass, but was error: %s", record.Error)
+	}
+	// the think time between the steps is part of the transaction
+	if record.responseTime < 50*time.Millisecond || record.responseTime < record.steps[0].responseTime+record.steps[1].responseTime {
+		t.Fatalf("expected the wall-clock time of the transaction, got %s", record.responseTime)
+	}
+}
+
+func TestBenchmarkWithFailedScenarioStep(t *testing.T) {
+	ts := newScenarioServer()
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         1,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+	config.feeder, _ = NewFeeder("testdata/data.csv", nil, FeedSequential)
+	config.scenario, _ = LoadScenario("testdata/scenario.json", config)
+
+	// the token is not found, the flow ends at the first step
+	config.scenario.Steps[0].Extract["token"].JSON = "auth.missing"
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+	record := <-benchmark.collector
+	context.abort()
+
+	if _, ok := record.Error.(*ExtractError); !ok {
+		t.Fatalf("expected extract error, got %v", record.Error)
+	}
+
+	stats := &Stats{}
+	updateStats(stats, record)
+	if stats.errExtract != 1 || stats.errException != 0 {
+		t.Fatalf("expected an extraction failure apart from exceptions, got %d and %d", stats.errExtract, stats.errException)
+	}
+
+	if len(record.steps) != 1 {
+		t.Fatalf("expected the flow to end at the first step, got %d steps", len(record.steps))
+	}
+}
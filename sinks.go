@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sinkTimeout         = time.Duration(5) * time.Second
+	statsDMaxPacketSize = 1432 // fits the MTU of most networks
+)
+
+// responseTimeQuantiles are pushed for the response times of an interval
+var responseTimeQuantiles = []float64{50, 95, 99}
+
+// StatsDSink sends counters and gauges over UDP with DogStatsD tags
+type StatsDSink struct {
+	conn net.Conn
+	tags string
+}
+
+func NewStatsDSink(addr string, tags []Tag) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []string
+	for _, tag := range tags {
+		pairs = append(pairs, statsDEscape(tag.Key)+":"+statsDEscape(tag.Value))
+	}
+	var suffix string
+	if len(pairs) > 0 {
+		suffix = "|#" + strings.Join(pairs, ",")
+	}
+	return &StatsDSink{conn, suffix}, nil
+}
+
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
+
+func statsDEscape(s string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_").Replace(s)
+}
+
+func (s *StatsDSink) Push(aggregate *Aggregate) error {
+	lines := []string{
+		fmt.Sprintf("gb.requests:%d|c", aggregate.requests),
+		fmt.Sprintf("gb.failed:%d|c", aggregate.failed),
+		fmt.Sprintf("gb.received_bytes:%d|c", aggregate.received),
+		fmt.Sprintf("gb.sent_bytes:%d|c", aggregate.sent),
+		fmt.Sprintf("gb.inflight:%d|g", aggregate.inflight),
+		fmt.Sprintf("gb.workers:%d|g", aggregate.workers),
+	}
+	for _, errorType := range sortedKeys(aggregate.errors) {
+		lines = append(lines, fmt.Sprintf("gb.errors.%s:%d|c", errorType, aggregate.errors[errorType]))
+	}
+	if responseTimes := &aggregate.responseTimes; responseTimes.Count() > 0 {
+		lines = append(lines, fmt.Sprintf("gb.response_time.mean:%s|g", formatMilliseconds(responseTimes.Mean())))
+		for _, quantile := range responseTimeQuantiles {
+			lines = append(lines, fmt.Sprintf("gb.response_time.p%d:%s|g", int(quantile), formatMilliseconds(responseTimes.Percentile(quantile))))
+		}
+		lines = append(lines, fmt.Sprintf("gb.response_time.max:%s|g", formatMilliseconds(responseTimes.Max())))
+	}
+
+	// lines are packed into as few datagrams as fit
+	var packet bytes.Buffer
+	for _, line := range lines {
+		line += s.tags
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsDMaxPacketSize {
+			if _, err := s.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	_, err := s.conn.Write(packet.Bytes())
+	return err
+}
+
+// InfluxSink writes a point per interval in the line protocol over http
+type InfluxSink struct {
+	client   *http.Client
+	endpoint string
+	token    string
+	tags     string
+}
+
+func NewInfluxSink(endpoint string, token string, tags []Tag) *InfluxSink {
+	sorted := append([]Tag(nil), tags...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	var buffer bytes.Buffer
+	for _, tag := range sorted {
+		if tag.Value == "" {
+			// empty tag values are invalid in the line protocol
+			continue
+		}
+		fmt.Fprintf(&buffer, ",%s=%s", influxEscape(tag.Key), influxEscape(tag.Value))
+	}
+	return &InfluxSink{&http.Client{Timeout: sinkTimeout}, endpoint, token, buffer.String()}
+}
+
+func (s *InfluxSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func influxEscape(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", "").Replace(s)
+}
+
+func (s *InfluxSink) Push(aggregate *Aggregate) error {
+	fields := []string{
+		fmt.Sprintf("requests=%di", aggregate.requests),
+		fmt.Sprintf("failed=%di", aggregate.failed),
+		fmt.Sprintf("received_bytes=%di", aggregate.received),
+		fmt.Sprintf("sent_bytes=%di", aggregate.sent),
+		fmt.Sprintf("inflight=%di", aggregate.inflight),
+		fmt.Sprintf("workers=%di", aggregate.workers),
+	}
+	for _, errorType := range sortedKeys(aggregate.errors) {
+		fields = append(fields, fmt.Sprintf("errors_%s=%di", errorType, aggregate.errors[errorType]))
+	}
+	if responseTimes := &aggregate.responseTimes; responseTimes.Count() > 0 {
+		fields = append(fields, "response_time_mean="+formatMilliseconds(responseTimes.Mean()))
+		for _, quantile := range responseTimeQuantiles {
+			fields = append(fields, fmt.Sprintf("response_time_p%d=%s", int(quantile), formatMilliseconds(responseTimes.Percentile(quantile))))
+		}
+		fields = append(fields, "response_time_max="+formatMilliseconds(responseTimes.Max()))
+	}
+	end := aggregate.start.Add(aggregate.interval)
+	line := fmt.Sprintf("gb%s %s %d\n", s.tags, strings.Join(fields, ","), end.UnixNano())
+
+	request, err := http.NewRequest("POST", s.endpoint, strings.NewReader(line))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		request.Header.Set("Authorization", "Token "+s.token)
+	}
+	return sinkDo(s.client, request)
+}
+
+// OTLPSink exports the aggregates as OpenTelemetry metrics over http in
+// JSON, counters are delta sums and response times a summary
+type OTLPSink struct {
+	client   *http.Client
+	endpoint string
+	token    string
+	resource []otlpAttribute
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpNumberDataPoint struct {
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	TimeUnixNano      string `json:"timeUnixNano"`
+	AsInt             string `json:"asInt"`
+}
+
+type otlpQuantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpSummaryDataPoint struct {
+	StartTimeUnixNano string              `json:"startTimeUnixNano"`
+	TimeUnixNano      string              `json:"timeUnixNano"`
+	Count             string              `json:"count"`
+	Sum               float64             `json:"sum"`
+	QuantileValues    []otlpQuantileValue `json:"quantileValues"`
+}
+
+type otlpMetric struct {
+	Name    string       `json:"name"`
+	Unit    string       `json:"unit"`
+	Sum     *otlpSum     `json:"sum,omitempty"`
+	Gauge   *otlpGauge   `json:"gauge,omitempty"`
+	Summary *otlpSummary `json:"summary,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpSummaryDataPoint `json:"dataPoints"`
+}
+
+const otlpDelta = 1 // aggregation temporality of counters reset every interval
+
+func NewOTLPSink(endpoint string, token string, tags []Tag) *OTLPSink {
+	resource := make([]otlpAttribute, len(tags)+1)
+	resource[0].Key, resource[0].Value.StringValue = "service.name", "gohttpbench"
+	for i, tag := range tags {
+		resource[i+1].Key, resource[i+1].Value.StringValue = tag.Key, tag.Value
+	}
+	return &OTLPSink{&http.Client{Timeout: sinkTimeout}, endpoint, token, resource}
+}
+
+func (s *OTLPSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *OTLPSink) Push(aggregate *Aggregate) error {
+	start := strconv.FormatInt(aggregate.start.UnixNano(), 10)
+	end := strconv.FormatInt(aggregate.start.Add(aggregate.interval).UnixNano(), 10)
+
+	var metrics []*otlpMetric
+	counter := func(name, unit string, value int64) {
+		points := []otlpNumberDataPoint{{start, end, strconv.FormatInt(value, 10)}}
+		metrics = append(metrics, &otlpMetric{Name: name, Unit: unit, Sum: &otlpSum{points, otlpDelta, true}})
+	}
+	gauge := func(name string, value int64) {
+		points := []otlpNumberDataPoint{{start, end, strconv.FormatInt(value, 10)}}
+		metrics = append(metrics, &otlpMetric{Name: name, Unit: "1", Gauge: &otlpGauge{points}})
+	}
+
+	counter("gb.requests", "{request}", int64(aggregate.requests))
+	counter("gb.failed", "{request}", int64(aggregate.failed))
+	for _, errorType := range sortedKeys(aggregate.errors) {
+		counter("gb.errors."+errorType, "{request}", int64(aggregate.errors[errorType]))
+	}
+	counter("gb.received_bytes", "By", aggregate.received)
+	counter("gb.sent_bytes", "By", aggregate.sent)
+	gauge("gb.inflight", int64(aggregate.inflight))
+	gauge("gb.workers", int64(aggregate.workers))
+
+	if responseTimes := &aggregate.responseTimes; responseTimes.Count() > 0 {
+		point := otlpSummaryDataPoint{start, end, strconv.Itoa(responseTimes.Count()), float64(responseTimes.Sum()) / float64(time.Millisecond), nil}
+		point.QuantileValues = append(point.QuantileValues, otlpQuantileValue{0, float64(responseTimes.Min()) / float64(time.Millisecond)})
+		for _, quantile := range responseTimeQuantiles {
+			point.QuantileValues = append(point.QuantileValues, otlpQuantileValue{quantile / 100, float64(responseTimes.Percentile(quantile)) / float64(time.Millisecond)})
+		}
+		point.QuantileValues = append(point.QuantileValues, otlpQuantileValue{1, float64(responseTimes.Max()) / float64(time.Millisecond)})
+
+		metrics = append(metrics, &otlpMetric{Name: "gb.response_time", Unit: "ms", Summary: &otlpSummary{[]otlpSummaryDataPoint{point}}})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": s.resource},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]string{"name": "gohttpbench", "version": GBVersion},
+				"metrics": metrics,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	return sinkDo(s.client, request)
+}
+
+// sinkDo sends the request of an http sink, any status but 2xx is an error
+func sinkDo(client *http.Client, request *http.Request) error {
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+func formatMilliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+func sortedKeys(counts map[string]int) []string {
+	var keys []string
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
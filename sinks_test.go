@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAggregate() *Aggregate {
+	aggregate := &Aggregate{
+		start:    time.Unix(1700000000, 0),
+		interval: 10 * time.Second,
+		requests: 3,
+		failed:   1,
+		errors:   map[string]int{"connect": 1},
+		received: 2048,
+		inflight: 2,
+		workers:  4,
+	}
+	aggregate.responseTimes.Record(2 * time.Millisecond)
+	aggregate.responseTimes.Record(4 * time.Millisecond)
+	return aggregate
+}
+
+func TestStatsDSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewStatsDSink(conn.LocalAddr().String(), []Tag{{"url", "http://localhost/"}, {"commit", "4f2a9c1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Push(testAggregate()); err != nil {
+		t.Fatal(err)
+	}
+
+	packet := make([]byte, statsDMaxPacketSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(string(packet[:n]), "\n")
+	for _, line := range []string{
+		"gb.requests:3|c|#url:http://localhost/,commit:4f2a9c1",
+		"gb.errors.connect:1|c|#url:http://localhost/,commit:4f2a9c1",
+		"gb.received_bytes:2048|c|#url:http://localhost/,commit:4f2a9c1",
+		"gb.workers:4|g|#url:http://localhost/,commit:4f2a9c1",
+		"gb.response_time.mean:3.000|g|#url:http://localhost/,commit:4f2a9c1",
+	} {
+		found := false
+		for _, sent := range lines {
+			found = found || sent == line
+		}
+		if !found {
+			t.Errorf("expected %q in %q", line, lines)
+		}
+	}
+
+	sink.Close()
+	if err = sink.Push(testAggregate()); err == nil {
+		t.Fatal("expected the closed sink to fail")
+	}
+}
+
+func TestInfluxSink(t *testing.T) {
+	var line, authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		line, authorization = string(body), r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	sink := NewInfluxSink(ts.URL+"/write?db=gb", "secret", []Tag{{"url", "http://localhost/a b"}, {"concurrency", "4"}})
+	if err := sink.Push(testAggregate()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `gb,concurrency=4,url=http://localhost/a\ b requests=3i,failed=1i,received_bytes=2048i,sent_bytes=0i,inflight=2i,workers=4i,errors_connect=1i,` +
+		"response_time_mean=3.000,response_time_p50=4.000,response_time_p95=4.000,response_time_p99=4.000,response_time_max=4.000 1700000010000000000\n"
+	if line != expected {
+		t.Fatalf("expected %q, got %q", expected, line)
+	}
+	if authorization != "Token secret" {
+		t.Fatalf("expected the token, got %q", authorization)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	if err := NewInfluxSink(failing.URL, "", nil).Push(testAggregate()); err == nil || !strings.Contains(err.Error(), "database not found") {
+		t.Fatalf("expected the error of the endpoint, got %v", err)
+	}
+}
+
+func TestOTLPSink(t *testing.T) {
+	var request struct {
+		ResourceMetrics []struct {
+			Resource struct {
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeMetrics []struct {
+				Metrics []otlpMetric `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+	}))
+	defer ts.Close()
+
+	sink := NewOTLPSink(ts.URL+"/v1/metrics", "", []Tag{{"url", "http://localhost/"}})
+	if err := sink.Push(testAggregate()); err != nil {
+		t.Fatal(err)
+	}
+
+	resource := request.ResourceMetrics[0].Resource.Attributes
+	if len(resource) != 2 || resource[1].Key != "url" || resource[1].Value.StringValue != "http://localhost/" {
+		t.Fatalf("expected the tags as resource attributes, got %+v", resource)
+	}
+
+	metrics := make(map[string]otlpMetric)
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+	if sum := metrics["gb.requests"].Sum; sum == nil || sum.DataPoints[0].AsInt != "3" || sum.AggregationTemporality != otlpDelta || sum.DataPoints[0].TimeUnixNano != "1700000010000000000" {
+		t.Fatalf("expected a delta sum of 3 requests, got %+v", sum)
+	}
+	if gauge := metrics["gb.workers"].Gauge; gauge == nil || gauge.DataPoints[0].AsInt != "4" {
+		t.Fatalf("expected a gauge of 4 workers, got %+v", gauge)
+	}
+	if summary := metrics["gb.response_time"].Summary; summary == nil || summary.DataPoints[0].Count != "2" || summary.DataPoints[0].Sum != 6 {
+		t.Fatalf("expected a summary of 2 response times, got %+v", summary)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTCPKeepAlive = time.Duration(30) * time.Second
+)
+
+// TCPInfo is taken from the kernel when a connection is closed, on Linux only
+type TCPInfo struct {
+	RTT         time.Duration // smoothed round trip time
+	RTTVar      time.Duration
+	Retransmits int // segments retransmitted over the connection lifetime
+	Cwnd        int // congestion window in segments
+}
+
+// TCPInfoStats collects the TCPInfo of the connections of all http workers
+type TCPInfoStats struct {
+	mu          sync.Mutex
+	rtt         Histogram
+	sumOfRTTVar time.Duration
+	minCwnd     int
+	sumOfCwnd   int
+	retransmits int
+}
+
+func (s *TCPInfoStats) Add(info *TCPInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rtt.Count() == 0 || info.Cwnd < s.minCwnd {
+		s.minCwnd = info.Cwnd
+	}
+	s.rtt.Record(info.RTT)
+	s.sumOfRTTVar += info.RTTVar
+	s.sumOfCwnd += info.Cwnd
+	s.retransmits += info.Retransmits
+}
+
+// Merge adds the connections of other
+func (s *TCPInfoStats) Merge(other *TCPInfoStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if other.rtt.Count() == 0 {
+		return
+	}
+	if s.rtt.Count() == 0 || other.minCwnd < s.minCwnd {
+		s.minCwnd = other.minCwnd
+	}
+	s.rtt.Merge(&other.rtt)
+	s.sumOfRTTVar += other.sumOfRTTVar
+	s.sumOfCwnd += other.sumOfCwnd
+	s.retransmits += other.retransmits
+}
+
+// Snapshot copies the connections collected so far
+func (s *TCPInfoStats) Snapshot() *TCPInfoStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := &TCPInfoStats{}
+	snapshot.Merge(s)
+	return snapshot
+}
+
+// applyTCPOptions sets the socket options of the config on a connected
+// socket, other connections like Unix domain sockets are left alone
+func applyTCPOptions(config *Config, conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if config.tcpDelay {
+		if err := tcpConn.SetNoDelay(false); err != nil {
+			return err
+		}
+	}
+	if config.tcpLinger != nil {
+		if err := tcpConn.SetLinger(*config.tcpLinger); err != nil {
+			return err
+		}
+	}
+	if config.tcpSendBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(config.tcpSendBuffer); err != nil {
+			return err
+		}
+	}
+	if config.tcpReceiveBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(config.tcpReceiveBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
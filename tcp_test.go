@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestHTTPWithTCPOptionsAndInfo(t *testing.T) {
+	responseStr := "hello"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(responseStr))
+	}))
+	defer ts.Close()
+
+	linger := 0
+	config := &Config{
+		concurrency:      2,
+		requests:         10,
+		method:           "GET",
+		keepAlive:        true,
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+		tcpDelay:         true,
+		tcpLinger:        &linger,
+		tcpSendBuffer:    64 * 1024,
+		tcpReceiveBuffer: 64 * 1024,
+		tcpKeepAlive:     -1,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, len(responseStr))
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	for record := range benchmark.collector {
+		if record.Error != nil {
+			t.Fatalf("sent a http reqeust with tcp options but was error: %s", record.Error)
+		}
+	}
+	context.abort()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("TCP_INFO is collected on Linux only")
+	}
+
+	// the kept alive connection of each http worker is closed when it returns
+	tcpInfo := context.tcpInfo.Snapshot()
+	if tcpInfo.rtt.Count() != config.concurrency {
+		t.Fatalf("expected TCP_INFO of %d connections, got %d", config.concurrency, tcpInfo.rtt.Count())
+	}
+	if tcpInfo.rtt.Min() <= 0 || tcpInfo.minCwnd <= 0 {
+		t.Fatalf("expected a positive rtt and cwnd, got %s and %d", tcpInfo.rtt.Min(), tcpInfo.minCwnd)
+	}
+}
+
+func TestMonitorWithTCPInfoOfTimeLimitedRun(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("TCP_INFO is collected on Linux only")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      4,
+		timelimit:        1,
+		method:           "GET",
+		keepAlive:        true,
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+		tcpKeepAlive:     -1,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+	monitor := NewMonitor(context, benchmark.collector)
+
+	devnull, _ := os.Open(os.DevNull)
+	defer devnull.Close()
+	stdout := os.Stdout
+	os.Stdout = devnull
+
+	go monitor.Run()
+	go benchmark.Run()
+	stats := <-monitor.output
+
+	os.Stdout = stdout
+
+	// the kept alive connections are closed after the time limit ends the run
+	if stats.tcpInfo.rtt.Count() != config.concurrency {
+		t.Fatalf("expected TCP_INFO of %d connections, got %d", config.concurrency, stats.tcpInfo.rtt.Count())
+	}
+}
@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// readTCPInfo takes TCP_INFO of a tcp connection before it is closed
+func readTCPInfo(conn net.Conn) (*TCPInfo, bool) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, false
+	}
+
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return nil, false
+	}
+
+	var info syscall.TCPInfo
+	var errno syscall.Errno
+	err = rawConn.Control(func(fd uintptr) {
+		size := uint32(syscall.SizeofTCPInfo)
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_TCP, syscall.TCP_INFO,
+			uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	})
+	if err != nil || errno != 0 {
+		return nil, false
+	}
+
+	return &TCPInfo{
+		RTT:         time.Duration(info.Rtt) * time.Microsecond,
+		RTTVar:      time.Duration(info.Rttvar) * time.Microsecond,
+		Retransmits: int(info.Total_retrans),
+		Cwnd:        int(info.Snd_cwnd),
+	}, true
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"net"
+)
+
+// readTCPInfo is not supported but on Linux
+func readTCPInfo(conn net.Conn) (*TCPInfo, bool) {
+	return nil, false
+}
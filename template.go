@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"text/template"
+)
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// TemplateVars are the variables available to placeholders, eg. {{.Seq}}
+type TemplateVars struct {
+	Seq    int               // sequential counter of the job, starting at 1
+	Worker int               // id of the http worker sending the request, starting at 1
+	Data   map[string]string // row of the data feeder assigned to the job
+	Vars   map[string]string // variables extracted by the previous steps of a scenario
+}
+
+var templateFuncs = template.FuncMap{
+	"randInt":    randInt,
+	"randString": randString,
+	"uuid":       uuid,
+}
+
+// RequestTemplate renders a new request per job, the url, headers, cookies
+// and body of the configuration are evaluated as text/template
+type RequestTemplate struct {
+	config  *Config
+	url     *template.Template
+	headers []*template.Template
+	cookies []*template.Template
+	body    *template.Template
+	form    []*template.Template // values of form fields, files are not templated
+}
+
+func NewRequestTemplate(config *Config) (t *RequestTemplate, err error) {
+	t = &RequestTemplate{config: config}
+
+	if t.url, err = parseTemplate("url", config.url); err != nil {
+		return
+	}
+
+	for i, header := range config.headers {
+		var h *template.Template
+		if h, err = parseTemplate(fmt.Sprintf("header %d", i+1), header); err != nil {
+			return
+		}
+		t.headers = append(t.headers, h)
+	}
+
+	for i, cookie := range config.cookies {
+		var c *template.Template
+		if c, err = parseTemplate(fmt.Sprintf("cookie %d", i+1), cookie); err != nil {
+			return
+		}
+		t.cookies = append(t.cookies, c)
+	}
+
+	switch {
+	case config.form != nil:
+		for _, field := range config.form.fields {
+			var f *template.Template
+			if f, err = parseTemplate("form field "+field.name, field.value); err != nil {
+				return
+			}
+			t.form = append(t.form, f)
+		}
+	case config.bodyContent != nil:
+		if t.body, err = parseTemplate("body", string(config.bodyContent)); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func parseTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+func (t *RequestTemplate) Render(ctx context.Context, vars *TemplateVars) (request *http.Request, err error) {
+	config := *t.config
+
+	var buffer bytes.Buffer
+	if err = t.url.Execute(&buffer, vars); err != nil {
+		return
+	}
+	config.url = buffer.String()
+
+	config.headers = make([]string, len(t.headers))
+	for i, header := range t.headers {
+		buffer.Reset()
+		if err = header.Execute(&buffer, vars); err != nil {
+			return
+		}
+		config.headers[i] = buffer.String()
+	}
+
+	config.cookies = make([]string, len(t.cookies))
+	for i, cookie := range t.cookies {
+		buffer.Reset()
+		if err = cookie.Execute(&buffer, vars); err != nil {
+			return
+		}
+		config.cookies[i] = buffer.String()
+	}
+
+	if t.body != nil {
+		buffer.Reset()
+		if err = t.body.Execute(&buffer, vars); err != nil {
+			return
+		}
+		config.bodyContent = append([]byte(nil), buffer.Bytes()...)
+	}
+
+	if config.form != nil {
+		form := *config.form
+		form.fields = make([]*FormField, len(t.form))
+		for i, field := range t.form {
+			buffer.Reset()
+			if err = field.Execute(&buffer, vars); err != nil {
+				return
+			}
+			formField := *config.form.fields[i]
+			if formField.filename == "" {
+				formField.value = buffer.String()
+			}
+			form.fields[i] = &formField
+		}
+		if config.bodyContent, err = form.Encode(); err != nil {
+			return
+		}
+	}
+
+	return NewHTTPRequest(ctx, &config)
+}
+
+func randInt(min, max int) int {
+	if max <= min {
+		return min
+	}
+	return min + rand.Intn(max-min+1)
+}
+
+func randString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+// uuid returns a random (version 4) UUID
+func uuid() string {
+	b := make([]byte, 16)
+	crand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
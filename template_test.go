@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestRenderRequestTemplate(t *testing.T) {
+	config := &Config{
+		url:         "http://localhost/users/{{.Data.id}}?seq={{.Seq}}&worker={{.Worker}}",
+		method:      "POST",
+		headers:     []string{"X-Request-Id:{{uuid}}"},
+		bodyContent: []byte(`{"name":"{{.Data.name}}","n":{{randInt 5 5}},"s":"{{randString 4}}"}`),
+	}
+
+	template, err := NewRequestTemplate(config)
+	if err != nil {
+		t.Fatalf("parse template failed: %s", err)
+	}
+
+	vars := &TemplateVars{7, 3, map[string]string{"id": "42", "name": "alice"}, nil}
+	request, err := template.Render(context.Background(), vars)
+	if err != nil {
+		t.Fatalf("render template failed: %s", err)
+	}
+
+	if expected := "/users/42?seq=7&worker=3"; request.URL.RequestURI() != expected {
+		t.Fatalf("expected %s, got %s", expected, request.URL.RequestURI())
+	}
+
+	if ok, _ := regexp.MatchString(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, request.Header.Get("X-Request-Id")); !ok {
+		t.Fatalf("expected a uuid, got %s", request.Header.Get("X-Request-Id"))
+	}
+
+	body, _ := ioutil.ReadAll(request.Body)
+	if ok, _ := regexp.MatchString(`^{"name":"alice","n":5,"s":"[a-zA-Z0-9]{4}"}$`, string(body)); !ok {
+		t.Fatalf("unexpected body %s", body)
+	}
+
+	// the configuration is left untouched
+	if config.url != "http://localhost/users/{{.Data.id}}?seq={{.Seq}}&worker={{.Worker}}" {
+		t.Fatalf("expected config not to be modified, got %s", config.url)
+	}
+}
+
+func TestRenderRequestTemplateWithMissingData(t *testing.T) {
+	template, err := NewRequestTemplate(&Config{url: "http://localhost/{{.Data.id}}", method: "GET"})
+	if err != nil {
+		t.Fatalf("parse template failed: %s", err)
+	}
+
+	if _, err := template.Render(context.Background(), &TemplateVars{Data: map[string]string{}}); err == nil {
+		t.Fatal("expected missing key error")
+	}
+}
+
+func TestBenchmarkWithTemplate(t *testing.T) {
+
+	var mutex sync.Mutex
+	paths := make(map[string]int)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		paths[r.URL.Path]++
+		mutex.Unlock()
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      2,
+		requests:         6,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL + "/{{.Data.name}}",
+	}
+	config.feeder, _ = NewFeeder("testdata/data.csv", nil, FeedSequential)
+	config.template, _ = NewRequestTemplate(config)
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+	for record := range benchmark.collector {
+		if record.Error != nil {
+			t.Fatalf("sent a http reqeust but was error: %s", record.Error)
+		}
+	}
+	context.abort()
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if paths["/"+name] != 2 {
+			t.Fatalf("expected every row to be used twice, got %v", paths)
+		}
+	}
+}
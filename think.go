@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	ThinkFixed       = "fixed"
+	ThinkUniform     = "uniform"
+	ThinkNormal      = "normal"
+	ThinkExponential = "exponential"
+)
+
+var (
+	ErrInvalidThinkTime = errors.New("invalid think time, eg. '1s', 'uniform:500ms,1500ms', 'normal:1s,200ms' or 'exponential:1s'")
+)
+
+// ThinkTime is the pause of a virtual user between requests
+type ThinkTime struct {
+	distribution string
+	a, b         time.Duration // fixed: a, uniform: a to b, normal: mean a and stddev b, exponential: mean a
+}
+
+// ParseThinkTime parses '<duration>' or '<distribution>:<duration>[,<duration>]'
+func ParseThinkTime(s string) (t *ThinkTime, err error) {
+	distribution, params := ThinkFixed, s
+	if pos := strings.Index(s, ":"); pos >= 0 {
+		distribution, params = s[:pos], s[pos+1:]
+	}
+
+	var durations []time.Duration
+	for _, param := range strings.Split(params, ",") {
+		var d time.Duration
+		if d, err = time.ParseDuration(strings.TrimSpace(param)); err != nil || d < 0 {
+			return nil, ErrInvalidThinkTime
+		}
+		durations = append(durations, d)
+	}
+
+	t = &ThinkTime{distribution: distribution, a: durations[0]}
+	switch {
+	case (distribution == ThinkFixed || distribution == ThinkExponential) && len(durations) == 1:
+	case distribution == ThinkNormal && len(durations) == 2:
+		t.b = durations[1]
+	case distribution == ThinkUniform && len(durations) == 2 && durations[0] <= durations[1]:
+		t.b = durations[1]
+	default:
+		return nil, ErrInvalidThinkTime
+	}
+	return
+}
+
+func (t *ThinkTime) Next() (d time.Duration) {
+	switch t.distribution {
+	case ThinkUniform:
+		d = t.a + time.Duration(rand.Int63n(int64(t.b-t.a)+1))
+	case ThinkNormal:
+		d = t.a + time.Duration(rand.NormFloat64()*float64(t.b))
+	case ThinkExponential:
+		d = time.Duration(rand.ExpFloat64() * float64(t.a))
+	default:
+		d = t.a
+	}
+
+	if d < 0 {
+		d = 0
+	}
+	return
+}
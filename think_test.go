@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseThinkTime(t *testing.T) {
+	testData := map[string]ThinkTime{
+		"1s":                   ThinkTime{ThinkFixed, time.Second, 0},
+		"uniform:500ms,1500ms": ThinkTime{ThinkUniform, 500 * time.Millisecond, 1500 * time.Millisecond},
+		"normal:1s, 200ms":     ThinkTime{ThinkNormal, time.Second, 200 * time.Millisecond},
+		"exponential:250ms":    ThinkTime{ThinkExponential, 250 * time.Millisecond, 0},
+		"fixed:2s":             ThinkTime{ThinkFixed, 2 * time.Second, 0},
+	}
+
+	for testingData, expectedData := range testData {
+		actual, err := ParseThinkTime(testingData)
+		if err != nil || *actual != expectedData {
+			t.Errorf("expected %v for %s, got %v (%v)", expectedData, testingData, actual, err)
+		}
+	}
+
+	for _, testingData := range []string{"", "1", "-1s", "uniform:2s,1s", "normal:1s", "poisson:1s"} {
+		if _, err := ParseThinkTime(testingData); err != ErrInvalidThinkTime {
+			t.Errorf("expected %s for %q, got %v", ErrInvalidThinkTime, testingData, err)
+		}
+	}
+}
+
+func TestThinkTimeNext(t *testing.T) {
+	uniform, _ := ParseThinkTime("uniform:10ms,20ms")
+	normal, _ := ParseThinkTime("normal:10ms,100ms")
+	exponential, _ := ParseThinkTime("exponential:10ms")
+
+	for i := 0; i < 1000; i++ {
+		if d := uniform.Next(); d < 10*time.Millisecond || d > 20*time.Millisecond {
+			t.Fatalf("expected uniform think time within 10ms and 20ms, got %s", d)
+		}
+		if d := normal.Next(); d < 0 {
+			t.Fatalf("expected non-negative normal think time, got %s", d)
+		}
+		if d := exponential.Next(); d < 0 {
+			t.Fatalf("expected non-negative exponential think time, got %s", d)
+		}
+	}
+}
+
+func TestHTTPWorkerWithPacing(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         3,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		pacing:           time.Duration(100) * time.Millisecond,
+		url:              ts.URL,
+	}
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	var starts []time.Time
+	for range benchmark.collector {
+		starts = append(starts, time.Now())
+	}
+	context.abort()
+
+	if len(starts) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(starts))
+	}
+
+	if interval := starts[2].Sub(starts[0]); interval < time.Duration(190)*time.Millisecond {
+		t.Fatalf("expected requests to be paced 100ms apart, got %s for 2 intervals", interval)
+	}
+}
+
+func TestHTTPWorkerWithThinkTimeStopped(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      1,
+		requests:         2,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+	}
+	config.thinkTime, _ = ParseThinkTime("1h")
+
+	context := NewContext(config)
+	context.SetInt(FieldContentSize, 5)
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	<-benchmark.collector
+	context.stop()
+
+	// the thinking worker returns on graceful shutdown without sending the second request
+	select {
+	case _, ok := <-benchmark.collector:
+		if ok {
+			t.Fatal("expected no more records after stop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected thinking worker to return after stop")
+	}
+	context.abort()
+}
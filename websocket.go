@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	WebSocketText   = 0x1
+	WebSocketBinary = 0x2
+	WebSocketClose  = 0x8
+	WebSocketPing   = 0x9
+	WebSocketPong   = 0xa
+
+	webSocketGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	webSocketMaxMessage = 64 << 20
+	webSocketMaxPending = 1024 // messages sent at a rate awaiting their replies
+)
+
+var (
+	ErrWebSocketClosed = errors.New("websocket closed by the server")
+)
+
+// WebSocketConn is the client side of a websocket connection (RFC 6455),
+// upgraded by the http client so connections are dialed like any request
+type WebSocketConn struct {
+	rwc    io.ReadWriteCloser
+	reader *bufio.Reader
+
+	mu     sync.Mutex // serializes writes, pongs are written while reading
+	closed int32
+}
+
+// DialWebSocket sends request as the opening handshake and returns the
+// upgraded connection and the response of the server
+func DialWebSocket(client *http.Client, request *http.Request) (*WebSocketConn, *http.Response, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	request.Method = "GET"
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", key)
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, nil, &ConnectError{err}
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, resp, &ResponseError{fmt.Errorf("websocket handshake failed with status %s", resp.Status)}
+	}
+
+	if resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+		resp.Body.Close()
+		return nil, resp, &ResponseError{errors.New("websocket handshake failed with an invalid Sec-WebSocket-Accept")}
+	}
+
+	// the transport hands over the connection as the body of a 101 response
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, resp, &ExceptionError{errors.New("websocket upgrade is not supported by the transport")}
+	}
+
+	return &WebSocketConn{rwc: rwc, reader: bufio.NewReader(rwc)}, resp, nil
+}
+
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// WriteMessage sends a single masked frame
+func (c *WebSocketConn) WriteMessage(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | opcode // FIN
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = 0x80 | byte(length)
+	case length <= 0xffff:
+		header[1] = 0x80 | 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 0x80 | 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	header = append(header, mask...)
+
+	frame := make([]byte, len(header)+len(payload))
+	copy(frame, header)
+	for i, b := range payload {
+		frame[len(header)+i] = b ^ mask[i%4]
+	}
+
+	_, err := c.rwc.Write(frame)
+	return err
+}
+
+// ReadMessage returns the next text or binary message, fragments are joined
+// and pings are answered
+func (c *WebSocketConn) ReadMessage() (opcode byte, message []byte, err error) {
+	for {
+		fin, frameOpcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOpcode {
+		case WebSocketPing:
+			if err = c.WriteMessage(WebSocketPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case WebSocketPong:
+			continue
+		case WebSocketClose:
+			return 0, nil, ErrWebSocketClosed
+		case WebSocketText, WebSocketBinary:
+			opcode = frameOpcode
+		}
+
+		message = append(message, payload...)
+		if len(message) > webSocketMaxMessage {
+			return 0, nil, fmt.Errorf("websocket message exceeds %d bytes", webSocketMaxMessage)
+		}
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *WebSocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(c.reader, header); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err = io.ReadFull(c.reader, extended); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err = io.ReadFull(c.reader, extended); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > webSocketMaxMessage {
+		err = fmt.Errorf("websocket frame exceeds %d bytes", webSocketMaxMessage)
+		return
+	}
+
+	// servers must not mask, but unmasking costs nothing
+	var mask []byte
+	if header[1]&0x80 != 0 {
+		mask = make([]byte, 4)
+		if _, err = io.ReadFull(c.reader, mask); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+	for i := range mask {
+		for j := i; j < len(payload); j += 4 {
+			payload[j] ^= mask[i]
+		}
+	}
+	return
+}
+
+// Shutdown sends a close frame without waiting for the reply and closes the
+// connection
+func (c *WebSocketConn) Shutdown() error {
+	c.WriteMessage(WebSocketClose, []byte{0x03, 0xe8}) // 1000 normal closure
+	return c.Close()
+}
+
+// Close closes the connection, it may be called more than once and while
+// reading or writing to abort them
+func (c *WebSocketConn) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return nil
+	}
+	return c.rwc.Close()
+}
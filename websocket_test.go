@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoWebSocket answers the handshake and echoes messages unmasked
+func echoWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		w.WriteHeader(http.StatusUpgradeRequired)
+		return
+	}
+
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nServer: echo\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + webSocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+	rw.Flush()
+
+	ws := &WebSocketConn{rwc: conn, reader: bufio.NewReader(rw)}
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil || opcode == WebSocketClose {
+			return
+		}
+		if !fin || len(payload) >= 126 {
+			return
+		}
+		// ping the client before echoing to check pongs are answered
+		conn.Write([]byte{0x80 | WebSocketPing, 0})
+		conn.Write(append([]byte{0x80 | opcode, byte(len(payload))}, payload...))
+	}
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	// the example of RFC 6455
+	if accept := webSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("expected s3pPLMBiTxaQ9kYGzzhZRbK+xOo=, got %s", accept)
+	}
+}
+
+func TestHTTPWithWebSocket(t *testing.T) {
+	message := "ping"
+
+	ts := httptest.NewServer(http.HandlerFunc(echoWebSocket))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      2,
+		requests:         10,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+		websocket:        true,
+		wsMessage:        []byte(message),
+	}
+
+	context := NewContext(config)
+	if err := DetectHost(context); err != nil {
+		t.Fatal(err)
+	}
+	if context.GetString(FieldServerName) != "echo" {
+		t.Fatalf("expected server echo, got %s", context.GetString(FieldServerName))
+	}
+	benchmark := NewBenchmark(context)
+
+	go benchmark.Run()
+
+	upgrades := 0
+	for record := range benchmark.collector {
+		if record.Error != nil {
+			t.Fatalf("sent a websocket message but was error: %s", record.Error)
+		}
+		if record.contentSize != int64(len(message)) || record.bodySent != int64(len(message)) {
+			t.Fatalf("expected a %d bytes message echoed, got %d bytes sent and %d received", len(message), record.bodySent, record.contentSize)
+		}
+		if record.upgrade > 0 {
+			upgrades++
+		}
+	}
+	context.abort()
+
+	// each concurrent user keeps its websocket open
+	if upgrades != config.concurrency {
+		t.Fatalf("expected %d websocket upgrades, got %d", config.concurrency, upgrades)
+	}
+}
+
+func TestHTTPWithWebSocketRate(t *testing.T) {
+	message := "ping"
+
+	ts := httptest.NewServer(http.HandlerFunc(echoWebSocket))
+	defer ts.Close()
+
+	config := &Config{
+		concurrency:      2,
+		requests:         10,
+		method:           "GET",
+		executionTimeout: MaxExecutionTimeout,
+		url:              ts.URL,
+		websocket:        true,
+		wsMessage:        []byte(message),
+		wsRate:           100,
+	}
+
+	context := NewContext(config)
+	if err := DetectHost(context); err != nil {
+		t.Fatal(err)
+	}
+	benchmark := NewBenchmark(context)
+
+	start := time.Now()
+	go benchmark.Run()
+
+	records, upgrades := 0, 0
+	for record := range benchmark.collector {
+		if record.Error != nil {
+			t.Fatalf("sent a websocket message but was error: %s", record.Error)
+		}
+		if record.contentSize != int64(len(message)) || record.responseTime <= 0 {
+			t.Fatalf("expected the reply of a %d bytes message timed, got %d bytes in %s", len(message), record.contentSize, record.responseTime)
+		}
+		if record.upgrade > 0 {
+			upgrades++
+		}
+		records++
+	}
+	context.abort()
+
+	// every message is recorded once its reply arrives
+	if records != config.requests || upgrades != config.concurrency {
+		t.Fatalf("expected %d replies over %d websockets, got %d over %d", config.requests, config.concurrency, records, upgrades)
+	}
+	// 5 messages of each concurrent user are sent 10ms apart
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("expected messages to be sent at the rate, took %s", elapsed)
+	}
+}
+
+func TestParseConfigWebSocketRate(t *testing.T) {
+	config := parseTestConfig(t, "-n", "10", "-ws-rate", "50", "ws://localhost/")
+	if !config.websocket || config.wsRate != 50 {
+		t.Fatalf("expected a websocket at 50 messages per second, got %v", config.wsRate)
+	}
+
+	for _, args := range [][]string{
+		{"-n", "10", "-ws-rate", "50", "http://localhost/"},
+		{"-n", "10", "-ws-rate", "-1", "ws://localhost/"},
+		{"-n", "10", "-ws-rate", "50", "-pacing", "1s", "ws://localhost/"},
+	} {
+		flags := flag.NewFlagSet("gb", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		if _, err := ParseConfig(flags, args); err == nil {
+			t.Errorf("expected error for %q", args)
+		}
+	}
+}
+
+func TestHTTPWithWebSocketRejected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	request, _ := http.NewRequest("GET", ts.URL, nil)
+	_, _, err := DialWebSocket(NewClient(&Config{}, nil), request)
+	if _, ok := err.(*ResponseError); !ok {
+		t.Fatalf("expected a ResponseError, got %#v", err)
+	}
+}